@@ -16,34 +16,36 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"strconv"
-	"time"
 
+	"github.com/avast/retry-go"
+	dc "github.com/databendcloud/databend-go"
 	"github.com/pkg/errors"
 )
 
-func (c *Client) GetCurrentAccountInfo() (*AccountInfoDTO, error) {
+func (c *Client) GetCurrentAccountInfo(ctx context.Context) (*AccountInfoDTO, error) {
 	resp := struct {
 		Data AccountInfoDTO `json:"data"`
 	}{}
-	err := c.DoRequest("GET", "/api/v1/account/info", nil, nil, &resp)
+	err := c.DoRequest(ctx, "GET", "/api/v1/account/info", nil, nil, &resp)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get account: %w, %#v", err, &resp)
+		return nil, errors.Wrap(err, "failed to get account")
 	}
 	return &resp.Data, nil
 }
 
-func (c *Client) ListOrgs() ([]OrgMembershipDTO, error) {
+func (c *Client) ListOrgs(ctx context.Context) ([]OrgMembershipDTO, error) {
 	var orgs []OrgMembershipDTO
 	resp := struct {
 		Data []OrgMembershipDTO `json:"data"`
 	}{}
 
-	err := c.DoRequest("GET", "/api/v1/my/orgs", nil, nil, &resp)
+	err := c.DoRequest(ctx, "GET", "/api/v1/my/orgs", nil, nil, &resp)
 	if err != nil {
 		return nil, errors.Wrap(err, "list orgs request failed")
 	}
@@ -53,40 +55,36 @@ func (c *Client) ListOrgs() ([]OrgMembershipDTO, error) {
 	return orgs, nil
 }
 
-func (c *Client) UploadToStageByPresignURL(presignURL, fileName string, header map[string]interface{}, displayProgress bool) error {
+func (c *Client) UploadToStageByPresignURL(ctx context.Context, presignURL, fileName string, header map[string]interface{}, displayProgress bool) error {
 	fileContent, err := os.ReadFile(fileName)
 	if err != nil {
 		return err
 	}
-	file, err := os.Open(fileName)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-	body := bytes.NewBuffer(fileContent)
 
-	httpReq, err := http.NewRequest("PUT", presignURL, body)
-	if err != nil {
-		return err
-	}
-	for k, v := range header {
-		httpReq.Header.Set(k, fmt.Sprintf("%v", v))
-	}
-	httpReq.Header.Set("Content-Length", strconv.FormatInt(int64(len(body.Bytes())), 10))
-	httpClient := &http.Client{
-		Timeout: time.Second * 60,
-	}
-	httpResp, err := httpClient.Do(httpReq)
-	if err != nil {
-		return errors.Wrap(err, "failed to upload file with presign url")
-	}
-	defer httpResp.Body.Close()
-	httpRespBody, err := io.ReadAll(httpResp.Body)
-	if err != nil {
-		return err
-	}
-	if httpResp.StatusCode >= 400 {
-		return fmt.Errorf("request got bad status: %d req=%s resp=%s", httpResp.StatusCode, body, httpRespBody)
-	}
-	return nil
+	err = c.retry.do(ctx, true, func() error {
+		httpReq, err := http.NewRequestWithContext(ctx, "PUT", presignURL, bytes.NewReader(fileContent))
+		if err != nil {
+			return retry.Unrecoverable(err)
+		}
+		for k, v := range header {
+			httpReq.Header.Set(k, fmt.Sprintf("%v", v))
+		}
+		httpReq.Header.Set("Content-Length", strconv.FormatInt(int64(len(fileContent)), 10))
+		httpResp, err := c.uploadClient.Do(httpReq)
+		if err != nil {
+			c.logf("PUT %s: %v", fileName, err)
+			return errors.Wrap(err, "failed to upload file with presign url")
+		}
+		defer httpResp.Body.Close()
+		c.logf("PUT %s: %s", fileName, httpResp.Status)
+		httpRespBody, err := io.ReadAll(httpResp.Body)
+		if err != nil {
+			return err
+		}
+		if httpResp.StatusCode >= 400 {
+			return withRetryAfter(dc.NewAPIError("failed to upload file with presign url.", httpResp.StatusCode, httpRespBody), httpResp)
+		}
+		return nil
+	})
+	return wrapError(err)
 }
@@ -0,0 +1,462 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package apitest provides an in-process stand-in of the Databend Cloud
+// control plane for tests of bendsql and of programs built on its api
+// package.
+package apitest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/databendcloud/bendsql/api"
+)
+
+// Defaults of a Server created without options.
+const (
+	DefaultEmail    = "tester@databend.com"
+	DefaultPassword = "databend"
+	DefaultOrg      = "databend"
+	DefaultTenant   = "tn-databend"
+	DefaultAPIKey   = "apitest-api-key"
+)
+
+// Warehouse states, a resumed warehouse is Starting for the start delay
+// before it is Running.
+const (
+	StateSuspended = "Suspended"
+	StateStarting  = "Starting"
+	StateRunning   = "Running"
+)
+
+// Fault makes matching requests fail or respond slowly.
+type Fault struct {
+	// Method matches any method if empty.
+	Method string
+	// Path is a prefix of the matched paths, e.g. /api/v1/orgs.
+	Path string
+	// Status is sent instead of the normal response, 0 only delays it.
+	Status int
+	// Delay is waited before responding, or until the client gives up.
+	Delay time.Duration
+	// Times is how many requests fail, 0 means all of them.
+	Times int
+}
+
+type warehouse struct {
+	name    string
+	size    string
+	state   string
+	readyAt time.Time
+}
+
+type session struct {
+	email     string
+	expiresAt time.Time
+}
+
+// Server is a fake Databend Cloud endpoint with a single organization.
+type Server struct {
+	*httptest.Server
+
+	email      string
+	password   string
+	org        string
+	apiKey     string
+	tokenTTL   time.Duration
+	startDelay time.Duration
+
+	mu         sync.Mutex
+	sessions   map[string]session
+	refresh    map[string]string
+	warehouses map[string]*warehouse
+	faults     []*Fault
+	requests   []string
+}
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithUser sets the account that can sign in.
+func WithUser(email, password string) Option {
+	return func(s *Server) {
+		s.email = email
+		s.password = password
+	}
+}
+
+// WithOrg sets the slug of the organization.
+func WithOrg(org string) Option {
+	return func(s *Server) {
+		s.org = org
+	}
+}
+
+// WithAPIKey sets the API key that is accepted as access token.
+func WithAPIKey(key string) Option {
+	return func(s *Server) {
+		s.apiKey = key
+	}
+}
+
+// WithTokenTTL sets how long access tokens are valid, 1h by default.
+func WithTokenTTL(ttl time.Duration) Option {
+	return func(s *Server) {
+		s.tokenTTL = ttl
+	}
+}
+
+// WithStartDelay sets how long warehouses are Starting, 100ms by default.
+func WithStartDelay(delay time.Duration) Option {
+	return func(s *Server) {
+		s.startDelay = delay
+	}
+}
+
+// NewServer starts a Server, callers should call Close when finished.
+func NewServer(opts ...Option) *Server {
+	s := &Server{
+		email:      DefaultEmail,
+		password:   DefaultPassword,
+		org:        DefaultOrg,
+		apiKey:     DefaultAPIKey,
+		tokenTTL:   time.Hour,
+		startDelay: 100 * time.Millisecond,
+		sessions:   map[string]session{},
+		refresh:    map[string]string{},
+		warehouses: map[string]*warehouse{},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// AddWarehouse creates a warehouse in the given state.
+func (s *Server) AddWarehouse(name, size, state string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.warehouses[name] = &warehouse{name: name, size: size, state: state}
+}
+
+// Warehouse returns the current state of a warehouse, it is empty if the
+// warehouse does not exist.
+func (s *Server) Warehouse(name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w, ok := s.warehouses[name]
+	if !ok {
+		return ""
+	}
+	return w.currentState()
+}
+
+// InjectFault makes matching requests fail until the fault is used up.
+func (s *Server) InjectFault(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &f)
+}
+
+// ExpireTokens makes all issued access tokens expire, refresh tokens stay
+// valid.
+func (s *Server) ExpireTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for token, sess := range s.sessions {
+		sess.expiresAt = time.Now()
+		s.sessions[token] = sess
+	}
+}
+
+// Requests returns "METHOD PATH" of every request served so far.
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+func (w *warehouse) currentState() string {
+	if w.state == StateStarting && !time.Now().Before(w.readyAt) {
+		w.state = StateRunning
+	}
+	return w.state
+}
+
+func (w *warehouse) dto() api.WarehouseStatusDTO {
+	dto := api.WarehouseStatusDTO{
+		Name:           w.name,
+		Size:           w.size,
+		State:          w.currentState(),
+		TotalInstances: 1,
+	}
+	if dto.State == StateRunning {
+		dto.ReadyInstances = 1
+	}
+	return dto
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+	fault := s.matchFault(r)
+	s.mu.Unlock()
+
+	if fault != nil {
+		if fault.Delay > 0 {
+			select {
+			case <-time.After(fault.Delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if fault.Status != 0 {
+			writeError(w, fault.Status, "InjectedFault", http.StatusText(fault.Status))
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path := r.URL.Path
+	switch {
+	case path == api.MetadataPath && r.Method == "GET":
+		writeJSON(w, api.EndpointMetadata{
+			APIVersion:  api.APIVersion,
+			AuthMethods: []string{api.AuthMethodPassword, api.AuthMethodToken},
+		})
+	case path == "/api/v1/account/sign-in" && r.Method == "POST":
+		s.signIn(w, r)
+	case path == "/api/v1/account/renew-token" && r.Method == "POST":
+		s.renewToken(w, r)
+	case path == "/api/v1/account/sign-out" && r.Method == "POST":
+		s.signOut(w, r)
+	case !s.authorized(r):
+		writeError(w, http.StatusUnauthorized, "Unauthorized", "invalid or expired access token")
+	case path == "/api/v1/account/info" && r.Method == "GET":
+		writeData(w, api.AccountInfoDTO{
+			ID:              1,
+			Email:           s.email,
+			Name:            strings.Split(s.email, "@")[0],
+			State:           "active",
+			DefaultOrgSlug:  s.org,
+			PasswordEnabled: true,
+		})
+	case path == "/api/v1/my/orgs" && r.Method == "GET":
+		writeData(w, []api.OrgMembershipDTO{{
+			ID:           1,
+			AccountID:    1,
+			AccountEmail: s.email,
+			OrgSlug:      s.org,
+			OrgName:      s.org,
+			OrgState:     "active",
+			OrgTenantID:  DefaultTenant,
+			Gateway:      strings.TrimPrefix(s.URL, "http://"),
+			MemberKind:   "owner",
+		}})
+	case strings.HasPrefix(path, "/api/v1/orgs/"):
+		s.serveWarehouses(w, r)
+	default:
+		writeError(w, http.StatusNotFound, "NotFound", "no route for "+r.Method+" "+path)
+	}
+}
+
+// matchFault returns the first fault matching r and uses it up.
+func (s *Server) matchFault(r *http.Request) *Fault {
+	for i, f := range s.faults {
+		if (f.Method != "" && f.Method != r.Method) || !strings.HasPrefix(r.URL.Path, f.Path) {
+			continue
+		}
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				s.faults = append(s.faults[:i], s.faults[i+1:]...)
+			}
+		}
+		return f
+	}
+	return nil
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" {
+		return false
+	}
+	if token == s.apiKey {
+		return true
+	}
+	sess, ok := s.sessions[token]
+	return ok && time.Now().Before(sess.expiresAt)
+}
+
+type tokenData struct {
+	AccessToken  string    `json:"accessToken"`
+	RefreshToken string    `json:"refreshToken"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+}
+
+func (s *Server) issueToken(w http.ResponseWriter, email string) {
+	data := tokenData{
+		AccessToken:  randomToken(),
+		RefreshToken: randomToken(),
+		ExpiresAt:    time.Now().Add(s.tokenTTL),
+	}
+	s.sessions[data.AccessToken] = session{email: email, expiresAt: data.ExpiresAt}
+	s.refresh[data.RefreshToken] = email
+	writeData(w, data)
+}
+
+func (s *Server) signIn(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "BadRequest", err.Error())
+		return
+	}
+	if req.Email != s.email || req.Password != s.password {
+		writeError(w, http.StatusUnauthorized, "Unauthorized", "wrong email or password")
+		return
+	}
+	s.issueToken(w, req.Email)
+}
+
+// renewToken issues a new token, refresh tokens are single use.
+func (s *Server) renewToken(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "BadRequest", err.Error())
+		return
+	}
+	email, ok := s.refresh[req.RefreshToken]
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized", "invalid refresh token")
+		return
+	}
+	delete(s.refresh, req.RefreshToken)
+	s.issueToken(w, email)
+}
+
+func (s *Server) signOut(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&req)
+	delete(s.refresh, req.RefreshToken)
+	delete(s.sessions, strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+	writeData(w, nil)
+}
+
+// serveWarehouses serves /api/v1/orgs/ORG/tenant/warehouses[/NAME[/ACTION]].
+func (s *Server) serveWarehouses(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/orgs/"), "/")
+	if len(parts) < 3 || parts[1] != "tenant" || parts[2] != "warehouses" {
+		writeError(w, http.StatusNotFound, "NotFound", "no route for "+r.Method+" "+r.URL.Path)
+		return
+	}
+	if parts[0] != s.org {
+		writeError(w, http.StatusNotFound, "OrgNotFound", "org "+parts[0]+" not found")
+		return
+	}
+	parts = parts[3:]
+
+	if len(parts) == 0 {
+		switch r.Method {
+		case "GET":
+			names := make([]string, 0, len(s.warehouses))
+			for name := range s.warehouses {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			list := make([]api.WarehouseStatusDTO, 0, len(names))
+			for _, name := range names {
+				list = append(list, s.warehouses[name].dto())
+			}
+			writeData(w, list)
+		case "POST":
+			var req api.CreateWarehouseRequestBody
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+				writeError(w, http.StatusBadRequest, "BadRequest", "warehouse name is required")
+				return
+			}
+			if _, ok := s.warehouses[req.Name]; ok {
+				writeError(w, http.StatusConflict, "WarehouseExists", "warehouse "+req.Name+" already exists")
+				return
+			}
+			s.warehouses[req.Name] = &warehouse{name: req.Name, size: req.Size, state: StateStarting, readyAt: time.Now().Add(s.startDelay)}
+			writeData(w, nil)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method+" is not allowed")
+		}
+		return
+	}
+
+	wh, ok := s.warehouses[parts[0]]
+	if !ok {
+		writeError(w, http.StatusNotFound, "WarehouseNotFound", "warehouse "+parts[0]+" not found")
+		return
+	}
+	switch {
+	case len(parts) == 1 && r.Method == "GET":
+		writeData(w, wh.dto())
+	case len(parts) == 1 && r.Method == "DELETE":
+		delete(s.warehouses, wh.name)
+		writeData(w, nil)
+	case len(parts) == 2 && parts[1] == "resume" && r.Method == "POST":
+		if wh.currentState() == StateSuspended {
+			wh.state = StateStarting
+			wh.readyAt = time.Now().Add(s.startDelay)
+		}
+		writeData(w, nil)
+	case len(parts) == 2 && parts[1] == "suspend" && r.Method == "POST":
+		wh.state = StateSuspended
+		writeData(w, nil)
+	default:
+		writeError(w, http.StatusNotFound, "NotFound", "no route for "+r.Method+" "+r.URL.Path)
+	}
+}
+
+func randomToken() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeData(w http.ResponseWriter, data interface{}) {
+	writeJSON(w, map[string]interface{}{"data": data})
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": code, "message": message})
+}
@@ -0,0 +1,104 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apitest_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/databendcloud/bendsql/api"
+	"github.com/databendcloud/bendsql/api/apitest"
+)
+
+func newClient(t *testing.T, srv *apitest.Server, opts ...api.Option) *api.Client {
+	c, err := api.New(append([]api.Option{api.WithEndpoint(srv.URL), api.WithOrg(apitest.DefaultOrg)}, opts...)...)
+	assert.NoError(t, err)
+	return c
+}
+
+func TestServerLogin(t *testing.T) {
+	srv := apitest.NewServer(apitest.WithTokenTTL(time.Minute))
+	defer srv.Close()
+	ctx := context.Background()
+
+	c := newClient(t, srv)
+	assert.Error(t, c.Login(ctx, apitest.DefaultEmail, "wrong"))
+	assert.NoError(t, c.Login(ctx, apitest.DefaultEmail, apitest.DefaultPassword))
+	account, err := c.GetCurrentAccountInfo(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, apitest.DefaultEmail, account.Email)
+	orgs, err := c.ListOrgs(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, apitest.DefaultOrg, orgs[0].OrgSlug)
+
+	// the token expires within the refresh skew, so it is renewed first
+	srv.ExpireTokens()
+	_, err = c.ListWarehouses(ctx)
+	assert.NoError(t, err)
+	assert.Contains(t, srv.Requests(), "POST /api/v1/account/renew-token")
+}
+
+func TestServerWarehouses(t *testing.T) {
+	srv := apitest.NewServer(apitest.WithStartDelay(50 * time.Millisecond))
+	defer srv.Close()
+	srv.AddWarehouse("w1", "Small", apitest.StateSuspended)
+	ctx := context.Background()
+	c := newClient(t, srv, api.WithTokenSource(api.StaticToken(apitest.DefaultAPIKey)))
+
+	assert.NoError(t, c.ResumeWarehouse(ctx, "w1"))
+	assert.Equal(t, apitest.StateStarting, srv.Warehouse("w1"))
+	assert.NoError(t, c.WaitWarehouseRunning(ctx, "w1", 5*time.Second))
+	assert.NoError(t, c.SuspendWarehouse(ctx, "w1"))
+	assert.Equal(t, apitest.StateSuspended, srv.Warehouse("w1"))
+
+	assert.NoError(t, c.CreateWarehouse(ctx, "w2", "XSmall", ""))
+	assert.Error(t, c.CreateWarehouse(ctx, "w2", "XSmall", ""))
+	warehouses, err := c.ListWarehouses(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, warehouses, 2)
+	assert.NoError(t, c.DeleteWarehouse(ctx, "w2"))
+	_, err = c.ViewWarehouse(ctx, "w2")
+	assert.Equal(t, api.ErrorNotFound, api.AsError(err).Kind)
+}
+
+func TestServerFaults(t *testing.T) {
+	srv := apitest.NewServer()
+	defer srv.Close()
+	ctx := context.Background()
+	api.SetRetryPolicy(api.RetryPolicy{Delay: time.Millisecond})
+	defer api.SetRetryPolicy(api.RetryPolicy{})
+	c := newClient(t, srv, api.WithTokenSource(api.StaticToken(apitest.DefaultAPIKey)))
+
+	// retried until the fault is used up
+	srv.InjectFault(apitest.Fault{Method: "GET", Path: "/api/v1/my/orgs", Status: http.StatusServiceUnavailable, Times: 2})
+	_, err := c.ListOrgs(ctx)
+	assert.NoError(t, err)
+
+	srv.InjectFault(apitest.Fault{Path: "/api/v1/orgs", Status: http.StatusUnauthorized, Times: 1})
+	_, err = c.ListWarehouses(ctx)
+	assert.Equal(t, api.ErrorAuth, api.AsError(err).Kind)
+
+	srv.InjectFault(apitest.Fault{Path: "/api/v1/account", Delay: time.Second})
+	ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = c.GetCurrentAccountInfo(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+}
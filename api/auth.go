@@ -15,6 +15,7 @@
 package api
 
 import (
+	"context"
 	"net/http"
 	"time"
 
@@ -24,16 +25,16 @@ import (
 	"github.com/databendcloud/bendsql/internal/config"
 )
 
-func (c *Client) DoAuthRequest(method, path string, headers http.Header, req interface{}, resp interface{}) error {
+func (c *Client) DoAuthRequest(ctx context.Context, method, path string, headers http.Header, req interface{}, resp interface{}) error {
 	if headers != nil {
 		headers = headers.Clone()
 	} else {
 		headers = http.Header{}
 	}
-	return c.request(method, path, headers, req, resp)
+	return c.request(ctx, method, path, headers, req, resp)
 }
 
-func (c *Client) Login(email, password string) error {
+func (c *Client) Login(ctx context.Context, email, password string) error {
 	req := struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
@@ -49,7 +50,7 @@ func (c *Client) Login(email, password string) error {
 			ExpiresAt    time.Time `json:"expiresAt"`
 		} `json:"data,omitempty"`
 	}{}
-	err := c.DoAuthRequest("POST", path, nil, &req, &resp)
+	err := c.DoAuthRequest(ctx, "POST", path, nil, &req, &resp)
 	var apiErr dc.APIError
 	if errors.As(err, &apiErr) && dc.IsAuthFailed(err) {
 		apiErr.Hint = "" // shows the server replied message if auth Err
@@ -64,15 +65,155 @@ func (c *Client) Login(email, password string) error {
 	}
 
 	// NOTE: should not write config here, in login command instead
-	c.cfg.Token = token
+	c.setToken(token)
 	return nil
 }
 
-func (c *Client) RefreshToken() error {
+// LoginWithToken uses an API key or personal access token, which is never
+// refreshed, instead of signing in.
+func (c *Client) LoginWithToken(token string) {
+	// NOTE: should not write config here, in login command instead
+	c.setToken(&config.Token{AccessToken: token})
+}
+
+// LoginWithEnvToken makes requests with BENDSQL_TOKEN only, the token stored
+// in the profile is forgotten so that WriteConfig does not save it for
+// another endpoint or account.
+func (c *Client) LoginWithEnvToken() {
+	c.setToken(nil)
+}
+
+// TokenInfo describes the token requests are made with.
+type TokenInfo struct {
+	// Source is BENDSQL_TOKEN or the profile the token is stored in.
+	Source      string
+	ExpiresAt   time.Time
+	Refreshable bool
+}
+
+// TokenInfo returns nil when not logged in.
+func (c *Client) TokenInfo() (*TokenInfo, error) {
+	token, err := c.currentToken()
+	if err != nil || token == nil {
+		return nil, err
+	}
+	info := &TokenInfo{
+		Source:      "profile " + c.profile,
+		ExpiresAt:   token.ExpiresAt,
+		Refreshable: token.Refreshable(),
+	}
+	if c.standalone {
+		info.Source = "client"
+	} else if config.EnvToken() != nil {
+		info.Source = config.TokenEnv
+	}
+	return info, nil
+}
+
+// Logout revokes the stored session on the server and forgets it, the
+// caller saves the config. API keys are not revoked.
+func (c *Client) Logout(ctx context.Context) error {
+	token, err := c.storedToken()
+	if err != nil || token == nil {
+		return err
+	}
+	c.setToken(nil)
+	if !token.Refreshable() {
+		return nil
+	}
+	req := struct {
+		RefreshToken string `json:"refreshToken"`
+	}{
+		RefreshToken: token.RefreshToken,
+	}
+	headers := http.Header{}
+	headers.Set(authorization, "Bearer "+token.AccessToken)
+	err = c.DoAuthRequest(ctx, "POST", "/api/v1/account/sign-out", headers, &req, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to revoke session")
+	}
+	return nil
+}
+
+// RefreshToken renews the access token while holding the config lock. A
+// refresh token is single use, so the token saved by another bendsql process
+// is preferred over ours when it is newer.
+func (c *Client) RefreshToken(ctx context.Context) error {
+	if c.standalone {
+		token, err := c.renewToken(ctx, c.token)
+		if err != nil {
+			return err
+		}
+		c.setToken(token)
+		return nil
+	}
+	if config.EnvToken() != nil {
+		return errors.Errorf("%s can not be refreshed", config.TokenEnv)
+	}
+	return config.Update(func(cfg *config.Config) error {
+		current, err := c.storedToken()
+		if err != nil {
+			return err
+		}
+		p := cfg.UpsertProfile(c.profile)
+		// another process may have switched accounts meanwhile
+		var stored *config.CloudConfig
+		if p.Cloud != nil {
+			stored = p.Cloud.FindAccount(c.base.Key())
+		}
+		if stored != nil {
+			latest, err := config.UnsealToken(stored.Token)
+			if err != nil {
+				return errors.Wrap(err, "failed to read token")
+			}
+			if latest != nil && (current == nil || latest.RefreshToken != current.RefreshToken) {
+				current = latest
+				if !latest.NeedsRefresh() {
+					c.setToken(latest)
+					return nil
+				}
+			}
+		}
+		token, err := c.renewToken(ctx, current)
+		if err != nil {
+			return err
+		}
+		c.setToken(token)
+
+		// only the token is saved, other keys of the profile may have been
+		// changed by another process
+		if stored == nil {
+			if p.Cloud != nil {
+				// logged out by another process, the token is kept in memory only
+				return nil
+			}
+			p.Target = config.TARGET_CLOUD
+			p.Cloud = &config.CloudConfig{}
+			*p.Cloud = *c.base
+			p.Cloud.Accounts = nil
+			stored = p.Cloud
+		}
+		stored.Token, err = cfg.SealToken(c.profile, stored.Key(), token)
+		if err != nil {
+			return errors.Wrap(err, "failed to write config")
+		}
+		return nil
+	})
+}
+
+// renewToken exchanges the refresh token of current for a new token.
+func (c *Client) renewToken(ctx context.Context, current *config.Token) (*config.Token, error) {
+	if current == nil {
+		return nil, errNotLoggedIn()
+	}
+	if !current.Refreshable() {
+		return nil, newError(ErrorAuth, errors.New("the token can not be refreshed, please use `bendsql cloud login` to login again"))
+	}
+
 	req := struct {
 		RefreshToken string `json:"refreshToken"`
 	}{
-		RefreshToken: c.cfg.Token.RefreshToken,
+		RefreshToken: current.RefreshToken,
 	}
 	resp := struct {
 		Data struct {
@@ -82,19 +223,13 @@ func (c *Client) RefreshToken() error {
 		} `json:"data"`
 	}{}
 	path := "/api/v1/account/renew-token"
-	err := c.DoAuthRequest("POST", path, nil, &req, &resp)
+	err := c.DoAuthRequest(ctx, "POST", path, nil, &req, &resp)
 	if err != nil {
-		return errors.Wrap(err, "failed to refresh tokens")
+		return nil, errors.Wrap(err, "failed to refresh tokens")
 	}
-	token := &config.Token{
+	return &config.Token{
 		AccessToken:  resp.Data.AccessToken,
 		RefreshToken: resp.Data.RefreshToken,
 		ExpiresAt:    resp.Data.ExpiresAt,
-	}
-	c.cfg.Token = token
-	err = c.WriteConfig()
-	if err != nil {
-		return errors.Wrap(err, "failed to write config")
-	}
-	return nil
+	}, nil
 }
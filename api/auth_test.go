@@ -0,0 +1,55 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/databendcloud/bendsql/internal/config"
+)
+
+func TestLogout(t *testing.T) {
+	var revoked string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/account/sign-out", r.URL.Path)
+		assert.Equal(t, "Bearer access", r.Header.Get("Authorization"))
+		req := struct {
+			RefreshToken string `json:"refreshToken"`
+		}{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		revoked = req.RefreshToken
+	}))
+	defer srv.Close()
+
+	c := newTestClient(t, srv.URL)
+	c.setToken(&config.Token{AccessToken: "access", RefreshToken: "refresh", ExpiresAt: time.Now().Add(time.Hour)})
+	info, err := c.TokenInfo()
+	assert.NoError(t, err)
+	assert.Equal(t, "profile default", info.Source)
+	assert.True(t, info.Refreshable)
+
+	assert.NoError(t, c.Logout(context.Background()))
+	assert.Equal(t, "refresh", revoked)
+	info, err = c.TokenInfo()
+	assert.NoError(t, err)
+	assert.Nil(t, info)
+}
@@ -16,6 +16,8 @@ package api
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/json"
 	"io"
 	"net/http"
@@ -24,18 +26,47 @@ import (
 	"strings"
 	"time"
 
+	"github.com/avast/retry-go"
 	"github.com/databendcloud/bendsql/internal/config"
 	dc "github.com/databendcloud/databend-go"
 	"github.com/pkg/errors"
 )
 
 type Client struct {
-	cfg *config.CloudConfig
+	// cfg is the effective cloud config with environment and flag overrides,
+	// base is the one stored in the profile and written back by WriteConfig.
+	cfg     *config.CloudConfig
+	base    *config.CloudConfig
+	profile string
+
+	// token is cfg.Token with credential store references resolved
+	token *config.Token
+
+	// endpoints are registered with `bendsql cloud endpoint add`, their names
+	// are accepted in BENDSQL_API_ENDPOINT
+	endpoints map[string]*config.Endpoint
+
+	// httpClient and uploadClient share a transport, uploads of large files
+	// are not limited by the request timeout
+	httpClient   *http.Client
+	uploadClient *http.Client
+
+	retry  RetryPolicy
+	paging PagingOptions
+
+	// standalone clients are created by New, they never touch config.toml
+	// and build their transport from transportOpts
+	standalone    bool
+	transportOpts TransportOptions
+	tokenSource   TokenSource
+	logger        Logger
 }
 
 const (
 	accept          = "Accept"
+	acceptEncoding  = "Accept-Encoding"
 	authorization   = "Authorization"
+	contentEncoding = "Content-Encoding"
 	contentType     = "Content-Type"
 	jsonContentType = "application/json; charset=utf-8"
 	timeZone        = "Time-Zone"
@@ -45,32 +76,138 @@ const (
 	EndpointCN     = "https://app.databend.cn"
 )
 
-func NewClient() (*Client, error) {
-	cfg, err := config.GetConfig()
+func NewClient(cfg *config.Config) (*Client, error) {
+	profile := cfg.ActiveProfile()
+	base := &config.CloudConfig{
+		Endpoint: EndpointGlobal,
+	}
+	if p, ok := cfg.Profiles[profile]; ok && p.Cloud != nil {
+		base = p.Cloud
+	}
+	effective, _, err := cfg.Resolve()
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to get config")
+		return nil, errors.Wrap(err, "failed to resolve config")
+	}
+	cloudCfg := effective.Cloud
+	if cloudCfg == nil {
+		cloudCfg = &config.CloudConfig{}
+		*cloudCfg = *base
 	}
 
-	if cfg.Cloud == nil {
-		cfg.Cloud = &config.CloudConfig{
-			Endpoint: EndpointGlobal,
-		}
+	transport, err := newTransport(transportOptions)
+	if err != nil {
+		return nil, err
+	}
+	retryPolicy, err := newRetryPolicy(cfg.Retry)
+	if err != nil {
+		return nil, err
 	}
 
 	client := &Client{
-		cfg: cfg.Cloud,
+		cfg:       cloudCfg,
+		base:      base,
+		profile:   profile,
+		endpoints: cfg.Endpoints,
+		httpClient: &http.Client{
+			Transport: transport,
+			Timeout:   transportOptions.Timeout,
+		},
+		uploadClient: &http.Client{
+			Transport: transport,
+		},
+		retry:  retryPolicy,
+		paging: DefaultPagingOptions,
 	}
 	return client, nil
 }
 
+// WriteConfig saves the cloud config and token of the profile to the latest
+// config.toml, changes made by other bendsql processes meanwhile are kept.
+// The account becomes the active one, other accounts stay logged in.
 func (c *Client) WriteConfig() error {
-	cfg, err := config.GetConfig()
+	if c.standalone {
+		return errStandalone
+	}
+	return config.Update(func(cfg *config.Config) error {
+		token, err := c.storedToken()
+		if err != nil {
+			return err
+		}
+		cloudCfg := *c.base
+		cloudCfg.Accounts = nil
+		cloudCfg.Token, err = cfg.SealToken(c.profile, cloudCfg.Key(), token)
+		if err != nil {
+			return errors.Wrap(err, "failed to save token")
+		}
+		p := cfg.UpsertProfile(c.profile)
+		p.Target = config.TARGET_CLOUD
+		if p.Cloud == nil {
+			p.Cloud = &config.CloudConfig{}
+		}
+		p.Cloud.AddAccount(&cloudCfg)
+		return nil
+	})
+}
+
+// currentToken returns the token requests are made with, BENDSQL_TOKEN takes
+// precedence over the stored one. It is nil if not logged in.
+func (c *Client) currentToken() (*config.Token, error) {
+	if c.standalone {
+		return c.token, nil
+	}
+	if t := config.EnvToken(); t != nil {
+		return t, nil
+	}
+	return c.storedToken()
+}
+
+// storedToken returns the token of the profile with its secrets resolved.
+func (c *Client) storedToken() (*config.Token, error) {
+	if c.token == nil && c.cfg.Token != nil {
+		token, err := config.UnsealToken(c.cfg.Token)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read token")
+		}
+		c.token = token
+	}
+	return c.token, nil
+}
+
+// FreshToken returns the token requests are made with, it is renewed when
+// it expires within config.TokenRefreshSkew. API keys and BENDSQL_TOKEN are
+// never renewed.
+func (c *Client) FreshToken(ctx context.Context) (*config.Token, error) {
+	if c.tokenSource != nil {
+		accessToken, err := c.tokenSource.Token(ctx)
+		if err != nil {
+			return nil, newError(ErrorAuth, errors.Wrap(err, "failed to get token"))
+		}
+		return &config.Token{AccessToken: accessToken}, nil
+	}
+	token, err := c.currentToken()
 	if err != nil {
-		return errors.Wrap(err, "failed to get config")
+		return nil, err
+	}
+	if token == nil {
+		return nil, errNotLoggedIn()
+	}
+	if token.NeedsRefresh() {
+		if err := c.RefreshToken(ctx); err != nil {
+			return nil, errors.Wrap(err, "failed to refresh token")
+		}
+		token = c.token
 	}
-	cfg.Target = config.TARGET_CLOUD
-	cfg.Cloud = c.cfg
-	return config.WriteConfig(cfg)
+	return token, nil
+}
+
+func (c *Client) setToken(token *config.Token) {
+	c.token = token
+	c.cfg.Token = token
+	c.base.Token = token
+}
+
+func (c *Client) CurrentProfile() string {
+	return c.profile
 }
 
 func (c *Client) CurrentWarehouse() string {
@@ -85,8 +222,12 @@ func (c *Client) CurrentEndpoint() string {
 	return c.cfg.Endpoint
 }
 
-func (c *Client) SetCurrentWarehouse(warehouse string) error {
-	warehouseList, err := c.ListWarehouses()
+func (c *Client) CurrentAccount() string {
+	return c.cfg.Account
+}
+
+func (c *Client) SetCurrentWarehouse(ctx context.Context, warehouse string) error {
+	warehouseList, err := c.ListWarehouses(ctx)
 	if err != nil {
 		return errors.Wrap(err, "failed to list warehouses")
 	}
@@ -94,48 +235,56 @@ func (c *Client) SetCurrentWarehouse(warehouse string) error {
 		return errors.New("no warehouse found")
 	}
 	if warehouse == "" {
-		c.cfg.Warehouse = warehouseList[0].Name
-		return nil
+		warehouse = warehouseList[0].Name
 	}
 	for i := range warehouseList {
 		if warehouse == warehouseList[i].Name {
 			c.cfg.Warehouse = warehouse
+			c.base.Warehouse = warehouse
 			return nil
 		}
 	}
-	return errors.Errorf("warehouse %s not found", warehouse)
+	return newError(ErrorNotFound, errors.Errorf("warehouse %s not found", warehouse))
 }
 
 func (c *Client) SetEndpoint(endpoint string) {
 	c.cfg.Endpoint = endpoint
+	c.base.Endpoint = endpoint
 }
 
-func (c *Client) SetCurrentOrg(org, tenant, gateway string) {
-	c.cfg.Org = org
-	c.cfg.Tenant = tenant
-	c.cfg.Gateway = gateway
+// SetAccount sets the email of the account logged in to.
+func (c *Client) SetAccount(account string) {
+	c.cfg.Account = account
+	c.base.Account = account
 }
 
-func (c *Client) DoRequest(method, path string, headers http.Header, req interface{}, resp interface{}) error {
-	if c.cfg.Token == nil {
-		return errors.New("please use `bendsql cloud login` to login your account first")
-	}
-	if c.cfg.Token.ExpiresAt.Before(time.Now()) {
-		err := c.RefreshToken()
-		if err != nil {
-			return errors.Wrap(err, "failed to refresh token")
+// SetCurrentOrg selects org, the warehouse of another org is forgotten.
+func (c *Client) SetCurrentOrg(org, tenant, gateway string) {
+	for _, cfg := range []*config.CloudConfig{c.cfg, c.base} {
+		if cfg.Org != org {
+			cfg.Warehouse = ""
 		}
+		cfg.Org = org
+		cfg.Tenant = tenant
+		cfg.Gateway = gateway
+	}
+}
+
+func (c *Client) DoRequest(ctx context.Context, method, path string, headers http.Header, req interface{}, resp interface{}) error {
+	token, err := c.FreshToken(ctx)
+	if err != nil {
+		return err
 	}
 	if headers != nil {
 		headers = headers.Clone()
 	} else {
 		headers = http.Header{}
 	}
-	headers.Set(authorization, "Bearer "+c.cfg.Token.AccessToken)
-	return c.request(method, path, headers, req, resp)
+	headers.Set(authorization, "Bearer "+token.AccessToken)
+	return c.request(ctx, method, path, headers, req, resp)
 }
 
-func (c *Client) request(method, path string, headers http.Header, req interface{}, resp interface{}) error {
+func (c *Client) request(ctx context.Context, method, path string, headers http.Header, req interface{}, resp interface{}) error {
 	var err error
 
 	reqBody := []byte{}
@@ -150,33 +299,62 @@ func (c *Client) request(method, path string, headers http.Header, req interface
 	if err != nil {
 		return errors.Wrap(err, "failed to make url")
 	}
-	httpReq, err := http.NewRequest(method, url, bytes.NewBuffer(reqBody))
-	if err != nil {
-		return errors.Wrap(err, "failed to create http request")
-	}
 
-	httpReq.Header = headers
-	httpReq.Header.Set(contentType, jsonContentType)
-	httpReq.Header.Set(accept, jsonContentType)
+	var httpRespBody []byte
+	err = c.retry.do(ctx, isIdempotent(method), func() error {
+		start := time.Now()
+		httpReq, err := http.NewRequestWithContext(ctx, method, url, bytes.NewBuffer(reqBody))
+		if err != nil {
+			return retry.Unrecoverable(errors.Wrap(err, "failed to create http request"))
+		}
+
+		httpReq.Header = headers.Clone()
+		httpReq.Header.Set(contentType, jsonContentType)
+		httpReq.Header.Set(accept, jsonContentType)
+		// negotiated explicitly so that it shows in traces and can be turned
+		// off, the transport then leaves decompressing to us
+		compressed := false
+		if strings.HasPrefix(path, "/v1/query") {
+			compressed = !c.paging.DisableCompression
+			if compressed {
+				httpReq.Header.Set(acceptEncoding, "gzip")
+			} else {
+				httpReq.Header.Set(acceptEncoding, "identity")
+			}
+		}
 
-	httpClient := &http.Client{}
-	httpResp, err := httpClient.Do(httpReq)
-	if err != nil {
-		return errors.Wrap(err, "http request error")
-	}
-	defer httpResp.Body.Close()
+		httpResp, err := c.httpClient.Do(httpReq)
+		if err != nil {
+			c.logf("%s %s: %v", method, path, err)
+			return errors.Wrap(err, "http request error")
+		}
+		defer httpResp.Body.Close()
+		c.logf("%s %s: %s (%s)", method, path, httpResp.Status, time.Since(start).Round(time.Millisecond))
 
-	httpRespBody, err := io.ReadAll(httpResp.Body)
-	if err != nil {
-		return errors.Wrap(err, "failed to read http response body")
-	}
+		var body io.Reader = httpResp.Body
+		if compressed && httpResp.Header.Get(contentEncoding) == "gzip" {
+			zr, err := gzip.NewReader(httpResp.Body)
+			if err != nil {
+				return errors.Wrap(err, "failed to read http response body")
+			}
+			body = zr
+		}
+		httpRespBody, err = io.ReadAll(body)
+		if err != nil {
+			return errors.Wrap(err, "failed to read http response body")
+		}
 
-	if httpResp.StatusCode == http.StatusUnauthorized {
-		return dc.NewAPIError("please use `bendsql cloud login` to login your account.", httpResp.StatusCode, httpRespBody)
-	} else if httpResp.StatusCode >= 500 {
-		return dc.NewAPIError("please retry again later.", httpResp.StatusCode, httpRespBody)
-	} else if httpResp.StatusCode >= 400 {
-		return dc.NewAPIError("please check your arguments.", httpResp.StatusCode, httpRespBody)
+		if httpResp.StatusCode == http.StatusUnauthorized {
+			return dc.NewAPIError("please use `bendsql cloud login` to login your account.", httpResp.StatusCode, httpRespBody)
+		} else if httpResp.StatusCode >= 500 {
+			return withRetryAfter(dc.NewAPIError("please retry again later.", httpResp.StatusCode, httpRespBody), httpResp)
+		} else if httpResp.StatusCode >= 400 {
+			return withRetryAfter(dc.NewAPIError("please check your arguments.", httpResp.StatusCode, httpRespBody), httpResp)
+		}
+		return nil
+	})
+	if err != nil {
+		return wrapError(err)
 	}
 
 	if resp != nil {
@@ -189,13 +367,19 @@ func (c *Client) request(method, path string, headers http.Header, req interface
 }
 
 func (c *Client) makeURL(path string) (string, error) {
-	apiEndpoint := os.Getenv("BENDSQL_API_ENDPOINT")
+	var apiEndpoint string
+	if !c.standalone {
+		apiEndpoint = os.Getenv("BENDSQL_API_ENDPOINT")
+	}
 	if apiEndpoint == "" {
 		apiEndpoint = c.cfg.Endpoint
 	}
 	if apiEndpoint == "" {
 		apiEndpoint = EndpointGlobal
 	}
+	if e, ok := c.endpoints[apiEndpoint]; ok {
+		apiEndpoint = e.URL
+	}
 	u, err := url.Parse(apiEndpoint)
 	if err != nil {
 		return "", errors.Wrap(err, "failed to parse api endpoint")
@@ -204,9 +388,10 @@ func (c *Client) makeURL(path string) (string, error) {
 	return u.String(), nil
 }
 
-func (c *Client) GetCloudDSN() (dsn string, err error) {
-	if c.cfg.Token == nil {
-		return "", errors.New("please use `bendsql cloud login` to login your account first")
+func (c *Client) GetCloudDSN(ctx context.Context) (dsn string, err error) {
+	token, err := c.FreshToken(ctx)
+	if err != nil {
+		return "", err
 	}
 
 	cfg := dc.NewConfig()
@@ -216,7 +401,7 @@ func (c *Client) GetCloudDSN() (dsn string, err error) {
 	cfg.Host = c.cfg.Gateway
 	cfg.Tenant = c.cfg.Tenant
 	cfg.Warehouse = c.cfg.Warehouse
-	cfg.AccessToken = c.cfg.Token.AccessToken
+	cfg.AccessToken = token.AccessToken
 
 	dsn = cfg.FormatDSN()
 	return
@@ -0,0 +1,86 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/databendcloud/bendsql/internal/config"
+)
+
+func TestDoRequestWithStaticToken(t *testing.T) {
+	var authorizations []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/my/orgs", r.URL.Path, "static tokens must not be refreshed")
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		_, _ = w.Write([]byte(`{"data":[{"orgSlug":"acme"}]}`))
+	}))
+	defer srv.Close()
+
+	c := newTestClient(t, srv.URL)
+	_, err := c.ListOrgs(context.Background())
+	assert.EqualError(t, err, "list orgs request failed: please use `bendsql cloud login` to login your account first")
+
+	c.LoginWithToken("api-key")
+	orgs, err := c.ListOrgs(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "acme", orgs[0].OrgSlug)
+
+	t.Setenv(config.TokenEnv, "env-token")
+	_, err = c.ListOrgs(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Bearer api-key", "Bearer env-token"}, authorizations)
+	assert.Error(t, c.RefreshToken(context.Background()))
+}
+
+func TestFreshTokenRenewsBeforeExpiry(t *testing.T) {
+	renewed := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/account/renew-token", r.URL.Path)
+		renewed++
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"accessToken":  "new",
+				"refreshToken": "refresh2",
+				"expiresAt":    time.Now().Add(time.Hour),
+			},
+		})
+	}))
+	defer srv.Close()
+	config.SetPath(filepath.Join(t.TempDir(), "config.toml"))
+	defer config.SetPath("")
+	t.Setenv("BENDSQL_VAULT_PASSPHRASE", "correct horse")
+
+	c := newTestClient(t, srv.URL)
+	c.setToken(&config.Token{AccessToken: "old", RefreshToken: "refresh", ExpiresAt: time.Now().Add(time.Hour)})
+	token, err := c.FreshToken(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "old", token.AccessToken)
+
+	// expiring within the skew is renewed although it is still valid
+	c.setToken(&config.Token{AccessToken: "old", RefreshToken: "refresh", ExpiresAt: time.Now().Add(time.Minute)})
+	token, err = c.FreshToken(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "new", token.AccessToken)
+	assert.Equal(t, 1, renewed)
+}
@@ -0,0 +1,56 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+	"time"
+
+	dc "github.com/databendcloud/databend-go"
+)
+
+// CloudAPI is the Databend Cloud API of an organization, commands and Go
+// programs embedding bendsql depend on it instead of *Client so that it can
+// be replaced in tests.
+type CloudAPI interface {
+	CurrentEndpoint() string
+	CurrentOrganization() string
+	CurrentWarehouse() string
+
+	// warehouses
+	ListWarehouses(ctx context.Context) ([]WarehouseStatusDTO, error)
+	ViewWarehouse(ctx context.Context, warehouseName string) (*WarehouseStatusDTO, error)
+	CreateWarehouse(ctx context.Context, warehouseName, size, tag string) error
+	CreateWarehouseAndWaitRunning(ctx context.Context, warehouseName, size, tag string) error
+	DeleteWarehouse(ctx context.Context, warehouseName string) error
+	ResumeWarehouse(ctx context.Context, warehouseName string) error
+	SuspendWarehouse(ctx context.Context, warehouseName string) error
+	WaitWarehouseRunning(ctx context.Context, warehouseName string, timeout time.Duration) error
+
+	// orgs and account
+	ListOrgs(ctx context.Context) ([]OrgMembershipDTO, error)
+	GetCurrentAccountInfo(ctx context.Context) (*AccountInfoDTO, error)
+
+	// query
+	Query(ctx context.Context, warehouseName, query string) (*dc.QueryResponse, error)
+	QuerySync(ctx context.Context, warehouseName string, sql string, respCh chan dc.QueryResponse) error
+	QueryPage(ctx context.Context, warehouseName, queryId, path string) (*dc.QueryResponse, error)
+	QueryRows(ctx context.Context, warehouseName, sql string) (*Rows, error)
+
+	// staging
+	UploadToStageByPresignURL(ctx context.Context, presignURL, fileName string, header map[string]interface{}, displayProgress bool) error
+}
+
+var _ CloudAPI = (*Client)(nil)
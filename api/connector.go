@@ -0,0 +1,265 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/avast/retry-go"
+
+	dc "github.com/databendcloud/databend-go"
+	"github.com/pkg/errors"
+
+	"github.com/databendcloud/bendsql/internal/config"
+)
+
+// connector opens databend connections with a DSN built for every new
+// connection, so connections opened later get a renewed cloud token.
+type connector struct {
+	dsn func() (string, error)
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	dsn, err := c.dsn()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get dsn")
+	}
+	cfg, err := dc.ParseDSN(dsn)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse dsn")
+	}
+	inner, err := dc.DatabendDriver{}.OpenWithConfig(ctx, *cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{
+		DatabendConn: inner.(*dc.DatabendConn),
+		rest:         dc.NewAPIClientFromConfig(cfg),
+		expires:      connExpiry(cfg.AccessToken, time.Now()),
+	}, nil
+}
+
+// connExpiry returns when a connection authenticated with accessToken is
+// replaced, half of config.TokenRefreshSkew before the token expires so that
+// a renewed one is used meanwhile. The expiry of tokens that are not JWTs is
+// unknown, such connections are replaced every TokenRefreshSkew/2.
+// Connections without a token, e.g. to Databend community, never are.
+func connExpiry(accessToken string, now time.Time) time.Time {
+	if accessToken == "" {
+		return time.Time{}
+	}
+	if exp, ok := jwtExpiry(accessToken); ok {
+		return exp.Add(-config.TokenRefreshSkew / 2)
+	}
+	return now.Add(config.TokenRefreshSkew / 2)
+}
+
+// jwtExpiry returns the exp claim of token if it is a JWT.
+func jwtExpiry(token string) (time.Time, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}, false
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(claims.Exp, 0), true
+}
+
+func (c *connector) Driver() driver.Driver {
+	return dc.DatabendDriver{}
+}
+
+// OpenDB returns a database handle whose connections are opened with the DSN
+// returned by dsn at that time, such as Config.GetDSN which renews expiring
+// cloud tokens. A connection keeps its token, so connections are replaced
+// before a token renewed within config.TokenRefreshSkew expires.
+func OpenDB(dsn func() (string, error)) *sql.DB {
+	return sql.OpenDB(&connector{dsn: dsn})
+}
+
+// conn runs queries without arguments through Pages, so that they are
+// stopped on the server when their context is cancelled. The driver
+// ignores contexts.
+type conn struct {
+	*dc.DatabendConn
+	rest *dc.APIClient
+	// expires is when the pool stops reusing the connection, zero if never
+	expires time.Time
+}
+
+// IsValid tells database/sql to replace connections whose token is about to
+// expire.
+func (c *conn) IsValid() bool {
+	return c.expires.IsZero() || time.Now().Before(c.expires)
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if len(args) > 0 {
+		return c.DatabendConn.QueryContext(ctx, query, args)
+	}
+	pages, err := DriverQuery(ctx, c.rest, query)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := NewRows(ctx, pages)
+	if err != nil {
+		return nil, err
+	}
+	return &driverRows{rows: rows}, nil
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if len(args) > 0 {
+		return c.DatabendConn.ExecContext(ctx, query, args)
+	}
+	pages, err := DriverQuery(ctx, c.rest, query)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, err := pages.Next(ctx); err == io.EOF {
+			return driver.RowsAffected(0), nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// DriverQuery starts a query with a databend-go client and returns its
+// pages, prefetched by DefaultPagingOptions. The client does not take
+// contexts, so its requests are awaited in the background; a query
+// cancelled before the server answered is stopped once it does, if within
+// StopTimeout. Its default transport negotiates gzip by itself.
+func DriverQuery(ctx context.Context, cli *dc.APIClient, sql string) (*Pages, error) {
+	type result struct {
+		resp *dc.QueryResponse
+		err  error
+	}
+	retryPolicy, err := newRetryPolicy(nil)
+	if err != nil {
+		return nil, err
+	}
+	fetch := driverFetcher(cli)
+	var first *dc.QueryResponse
+	err = retryPolicy.do(ctx, false, func() error {
+		ch := make(chan result, 1)
+		go func() {
+			resp, err := cli.DoQuery(ctx, sql, nil)
+			ch <- result{resp, err}
+		}()
+		select {
+		case r := <-ch:
+			first = r.resp
+			return r.err
+		case <-ctx.Done():
+			// wait a little for the ID, so that the query can be stopped
+			select {
+			case r := <-ch:
+				if r.err == nil {
+					return retry.Unrecoverable(cancelStarted(r.resp, fetch, ctx.Err()))
+				}
+			case <-time.After(StopTimeout):
+			}
+			return retry.Unrecoverable(cancelStarted(nil, fetch, ctx.Err()))
+		}
+	})
+	if ctx.Err() != nil && !isCancelled(err) {
+		return nil, cancelStarted(first, fetch, ctx.Err())
+	} else if err != nil {
+		return nil, wrapError(errors.Wrap(err, "query failed"))
+	}
+	pages := NewPages(first, fetch)
+	pages.Prefetch(DefaultPagingOptions.Prefetch, DefaultPagingOptions.MaxPrefetchBytes)
+	return pages, nil
+}
+
+// driverFetcher fetches pages with cli in the background, so that a
+// cancelled ctx is noticed while a request is in flight.
+func driverFetcher(cli *dc.APIClient) PageFetcher {
+	type result struct {
+		resp *dc.QueryResponse
+		err  error
+	}
+	return func(ctx context.Context, uri string) (*dc.QueryResponse, error) {
+		ch := make(chan result, 1)
+		go func() {
+			resp, err := cli.QueryPage(uri)
+			ch <- result{resp, err}
+		}()
+		select {
+		case r := <-ch:
+			return r.resp, r.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// driverRows are the rows of a query run by conn.
+type driverRows struct {
+	rows *Rows
+}
+
+func (r *driverRows) Columns() []string {
+	return r.rows.Columns()
+}
+
+func (r *driverRows) Close() error {
+	return r.rows.Close()
+}
+
+func (r *driverRows) Next(dest []driver.Value) error {
+	if !r.rows.Next() {
+		if err := r.rows.Err(); err != nil {
+			return err
+		}
+		return io.EOF
+	}
+	for i, v := range r.rows.values {
+		dest[i] = v
+	}
+	return nil
+}
+
+// ColumnTypeScanType implements driver.RowsColumnTypeScanType.
+func (r *driverRows) ColumnTypeScanType(index int) reflect.Type {
+	return r.rows.decoders[index].scanType
+}
+
+// ColumnTypeDatabaseTypeName implements driver.RowsColumnTypeDatabaseTypeName.
+func (r *driverRows) ColumnTypeDatabaseTypeName(index int) string {
+	return r.rows.types[index]
+}
+
+// ColumnTypeNullable implements driver.RowsColumnTypeNullable.
+func (r *driverRows) ColumnTypeNullable(index int) (nullable, ok bool) {
+	return r.rows.decoders[index].nullable, true
+}
@@ -0,0 +1,42 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/base64"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/databendcloud/bendsql/internal/config"
+)
+
+func TestConnExpiry(t *testing.T) {
+	now := time.Now()
+	// community connections have no token and are kept
+	assert.True(t, connExpiry("", now).IsZero())
+	assert.True(t, (&conn{}).IsValid())
+
+	exp := now.Add(time.Hour).Truncate(time.Second)
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"alice","exp":` + strconv.FormatInt(exp.Unix(), 10) + `}`))
+	jwt := "eyJhbGciOiJIUzI1NiJ9." + payload + ".sig"
+	assert.Equal(t, exp.Add(-config.TokenRefreshSkew/2), connExpiry(jwt, now))
+
+	// the expiry of opaque tokens is unknown
+	assert.Equal(t, now.Add(config.TokenRefreshSkew/2), connExpiry("api-key", now))
+	assert.False(t, (&conn{expires: now.Add(-time.Second)}).IsValid())
+}
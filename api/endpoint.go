@@ -0,0 +1,130 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/databendcloud/bendsql/internal/config"
+)
+
+// MetadataPath is where a Databend Cloud endpoint describes itself.
+const MetadataPath = "/.well-known/databend-cloud.json"
+
+// APIVersion is the control plane API bendsql speaks.
+const APIVersion = "v1"
+
+// Auth methods an endpoint can offer.
+const (
+	AuthMethodPassword = "password"
+	AuthMethodWeb      = "web"
+	AuthMethodToken    = "token"
+)
+
+type EndpointRegion struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// EndpointMetadata is the well-known document served at MetadataPath.
+type EndpointMetadata struct {
+	APIVersion  string           `json:"apiVersion"`
+	AuthMethods []string         `json:"authMethods"`
+	Regions     []EndpointRegion `json:"regions"`
+}
+
+// DiscoverEndpoint fetches the metadata of endpoint and checks that bendsql
+// can work with it.
+func DiscoverEndpoint(ctx context.Context, endpoint string) (*EndpointMetadata, error) {
+	endpoint, err := config.ParseEndpoint(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	transport, err := newTransport(transportOptions)
+	if err != nil {
+		return nil, err
+	}
+	httpClient := &http.Client{
+		Transport: transport,
+		Timeout:   transportOptions.Timeout,
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", endpoint+MetadataPath, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create http request")
+	}
+	retryPolicy, err := newRetryPolicy(nil)
+	if err != nil {
+		return nil, err
+	}
+	var httpResp *http.Response
+	err = retryPolicy.do(ctx, true, func() error {
+		httpResp, err = httpClient.Do(httpReq)
+		return err
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to reach %s", endpoint)
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("%s is not a Databend Cloud endpoint, GET %s returned %s", endpoint, MetadataPath, httpResp.Status)
+	}
+	body, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read endpoint metadata")
+	}
+	metadata := &EndpointMetadata{}
+	if err := json.Unmarshal(body, metadata); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal endpoint metadata")
+	}
+	if metadata.APIVersion != APIVersion {
+		return nil, errors.Errorf("%s serves API version %q, this bendsql supports %s", endpoint, metadata.APIVersion, APIVersion)
+	}
+	if len(metadata.AuthMethods) == 0 {
+		return nil, errors.Errorf("%s offers no auth methods", endpoint)
+	}
+	return metadata, nil
+}
+
+// Endpoint returns the config to register the endpoint with.
+func (m *EndpointMetadata) Endpoint(url string) *config.Endpoint {
+	e := &config.Endpoint{
+		URL:         url,
+		AuthMethods: m.AuthMethods,
+	}
+	for _, r := range m.Regions {
+		e.Regions = append(e.Regions, r.Name)
+	}
+	return e
+}
+
+// CheckAuthMethod returns an error if endpoint is known not to offer method.
+func CheckAuthMethod(endpoint *config.Endpoint, method string) error {
+	if endpoint == nil || len(endpoint.AuthMethods) == 0 {
+		return nil
+	}
+	for _, m := range endpoint.AuthMethods {
+		if m == method {
+			return nil
+		}
+	}
+	return errors.Errorf("%s doesn't support %s login, supported methods: %s",
+		endpoint.URL, method, strings.Join(endpoint.AuthMethods, ", "))
+}
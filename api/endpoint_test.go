@@ -0,0 +1,52 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiscoverEndpoint(t *testing.T) {
+	metadata := `{"apiVersion":"v1","authMethods":["web","token"],"regions":[{"name":"eu-1"}]}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != MetadataPath {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(metadata))
+	}))
+	defer srv.Close()
+
+	m, err := DiscoverEndpoint(context.Background(), srv.URL+"/")
+	assert.NoError(t, err)
+	e := m.Endpoint(srv.URL)
+	assert.Equal(t, []string{"web", "token"}, e.AuthMethods)
+	assert.Equal(t, []string{"eu-1"}, e.Regions)
+	assert.NoError(t, CheckAuthMethod(e, AuthMethodWeb))
+	assert.EqualError(t, CheckAuthMethod(e, AuthMethodPassword), srv.URL+" doesn't support password login, supported methods: web, token")
+	assert.NoError(t, CheckAuthMethod(nil, AuthMethodPassword))
+
+	metadata = `{"apiVersion":"v2","authMethods":["web"]}`
+	_, err = DiscoverEndpoint(context.Background(), srv.URL)
+	assert.EqualError(t, err, srv.URL+` serves API version "v2", this bendsql supports v1`)
+
+	_, err = DiscoverEndpoint(context.Background(), "app.databend.com")
+	assert.EqualError(t, err, "invalid endpoint app.databend.com, it should look like https://app.databend.com")
+}
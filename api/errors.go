@@ -0,0 +1,155 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	dc "github.com/databendcloud/databend-go"
+	"github.com/pkg/errors"
+)
+
+// ErrorKind classifies failures so that scripts can branch on them, each
+// kind has its own exit code.
+type ErrorKind string
+
+const (
+	ErrorAuth               ErrorKind = "auth"
+	ErrorNotFound           ErrorKind = "not_found"
+	ErrorQuota              ErrorKind = "quota"
+	ErrorWarehouseSuspended ErrorKind = "warehouse_suspended"
+	ErrorQuery              ErrorKind = "query"
+	ErrorNetwork            ErrorKind = "network"
+)
+
+// hints tell how to fix errors of each kind unless the server sent one.
+var hints = map[ErrorKind]string{
+	ErrorAuth:               "please use `bendsql cloud login` to login your account.",
+	ErrorNotFound:           "please check the name, e.g. with `bendsql cloud warehouse ls`.",
+	ErrorQuota:              "please retry later or raise the quota of your organization in Databend Cloud.",
+	ErrorWarehouseSuspended: "please resume it with `bendsql cloud warehouse resume`.",
+	ErrorNetwork:            "please check your network, --proxy and --timeout.",
+}
+
+// Error is a classified failure of a Databend Cloud request. The error it
+// wraps is still available to errors.As, e.g. dc.APIError.
+type Error struct {
+	Kind ErrorKind
+	// StatusCode is the HTTP status of the response, 0 if there was none.
+	StatusCode int
+	// Code is the Databend error code of query errors.
+	Code int
+	// Hint tells how to fix the error.
+	Hint string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func newError(kind ErrorKind, err error) *Error {
+	return &Error{Kind: kind, Hint: hints[kind], Err: err}
+}
+
+func errNotLoggedIn() error {
+	return newError(ErrorAuth, errors.New("please use `bendsql cloud login` to login your account first"))
+}
+
+// AsError returns the classified error in the chain of err, errors that are
+// not classified yet, such as those of the databend-go driver, are
+// classified now. It returns nil for other errors.
+func AsError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return classify(err)
+}
+
+// wrapError classifies err, errors of unknown kind are returned as they are.
+func wrapError(err error) error {
+	if e := AsError(err); e != nil && e.Err != err {
+		// keep the messages of errors wrapping the classified one
+		return &Error{Kind: e.Kind, StatusCode: e.StatusCode, Code: e.Code, Hint: e.Hint, Err: err}
+	} else if e != nil {
+		return e
+	}
+	return err
+}
+
+func classify(err error) *Error {
+	var apiErr dc.APIError
+	var queryErr *dc.QueryError
+	switch {
+	case errors.As(err, &apiErr):
+		e := newError(apiErrorKind(apiErr), err)
+		if e.Kind == "" {
+			return nil
+		}
+		e.StatusCode = apiErr.StatusCode
+		if apiErr.Hint != "" {
+			e.Hint = apiErr.Hint
+		}
+		return e
+	case errors.As(err, &queryErr):
+		kind := ErrorQuery
+		if isSuspended(queryErr.Message) {
+			kind = ErrorWarehouseSuspended
+		}
+		e := newError(kind, err)
+		e.Code = queryErr.Code
+		return e
+	case errors.Is(err, context.Canceled):
+		return nil
+	}
+	var urlErr *url.Error
+	var netErr net.Error
+	if errors.As(err, &urlErr) || errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) {
+		return newError(ErrorNetwork, err)
+	}
+	return nil
+}
+
+func apiErrorKind(apiErr dc.APIError) ErrorKind {
+	message := apiErr.RespBody.Error + " " + apiErr.RespBody.Message
+	switch {
+	case apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden:
+		return ErrorAuth
+	case apiErr.StatusCode == http.StatusNotFound:
+		return ErrorNotFound
+	case apiErr.StatusCode == http.StatusPaymentRequired || apiErr.StatusCode == http.StatusTooManyRequests ||
+		strings.Contains(strings.ToLower(message), "quota"):
+		return ErrorQuota
+	case isSuspended(message):
+		return ErrorWarehouseSuspended
+	}
+	return ""
+}
+
+func isSuspended(message string) bool {
+	return strings.Contains(strings.ToLower(message), "suspended")
+}
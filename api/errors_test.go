@@ -0,0 +1,74 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	dc "github.com/databendcloud/databend-go"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAsError(t *testing.T) {
+	tests := []struct {
+		err    error
+		kind   ErrorKind
+		status int
+		code   int
+	}{
+		{dc.NewAPIError("", http.StatusUnauthorized, nil), ErrorAuth, http.StatusUnauthorized, 0},
+		{errors.Wrap(dc.NewAPIError("", http.StatusNotFound, nil), "view warehouse"), ErrorNotFound, http.StatusNotFound, 0},
+		{dc.NewAPIError("", http.StatusBadRequest, []byte(`{"error":"QuotaExceeded","message":"warehouse quota exceeded"}`)), ErrorQuota, http.StatusBadRequest, 0},
+		{dc.NewAPIError("", http.StatusConflict, []byte(`{"message":"warehouse w1 is suspended"}`)), ErrorWarehouseSuspended, http.StatusConflict, 0},
+		{errors.Wrap(&dc.QueryError{Code: 1025, Message: "Unknown table t"}, "query"), ErrorQuery, 0, 1025},
+		{&net.DNSError{Name: "app.databend.com"}, ErrorNetwork, 0, 0},
+	}
+	for _, tt := range tests {
+		e := AsError(tt.err)
+		if assert.NotNil(t, e, "%v", tt.err) {
+			assert.Equal(t, tt.kind, e.Kind, "%v", tt.err)
+			assert.Equal(t, tt.status, e.StatusCode)
+			assert.Equal(t, tt.code, e.Code)
+		}
+	}
+	assert.Nil(t, AsError(dc.NewAPIError("", http.StatusBadRequest, nil)))
+	assert.Nil(t, AsError(errors.New("boom")))
+	assert.Nil(t, AsError(context.Canceled))
+}
+
+func TestRequestErrorKind(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error":"NotFound","message":"warehouse w1 not found"}`))
+	}))
+	defer srv.Close()
+
+	c := newTestClient(t, srv.URL)
+	c.LoginWithToken("api-key")
+	_, err := c.ViewWarehouse(context.Background(), "w1")
+	var e *Error
+	assert.True(t, errors.As(err, &e))
+	assert.Equal(t, ErrorNotFound, e.Kind)
+	assert.True(t, dc.IsNotFound(err))
+
+	c = newTestClient(t, srv.URL)
+	_, err = c.ListWarehouses(context.Background())
+	assert.Equal(t, ErrorAuth, AsError(err).Kind)
+}
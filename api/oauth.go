@@ -0,0 +1,227 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/avast/retry-go"
+	dc "github.com/databendcloud/databend-go"
+	"github.com/pkg/errors"
+
+	"github.com/databendcloud/bendsql/internal/config"
+)
+
+const (
+	oauthClientID      = "bendsql"
+	oauthAuthorizePath = "/oauth/authorize"
+	oauthTokenPath     = "/api/v1/oauth/token"
+	oauthCallbackPath  = "/callback"
+
+	defaultWebLoginTimeout = 5 * time.Minute
+)
+
+// WebLoginOptions configures LoginWeb.
+type WebLoginOptions struct {
+	// OpenURL shows the authorization page to the user, usually in a browser.
+	OpenURL func(url string) error
+	// Timeout is how long to wait for the user to authorize, 5 minutes if zero.
+	Timeout time.Duration
+}
+
+type oauthCallback struct {
+	code string
+	err  error
+}
+
+// LoginWeb signs in with the OAuth 2.0 authorization code flow with PKCE
+// (RFC 7636), which works for SSO accounts as well. The browser is sent back
+// to a loopback server on 127.0.0.1 that receives the authorization code.
+func (c *Client) LoginWeb(ctx context.Context, opts WebLoginOptions) error {
+	verifier, err := randomString(32)
+	if err != nil {
+		return err
+	}
+	state, err := randomString(16)
+	if err != nil {
+		return err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return errors.Wrap(err, "failed to start callback server")
+	}
+	redirectURI := fmt.Sprintf("http://%s%s", listener.Addr(), oauthCallbackPath)
+	callbacks := make(chan oauthCallback, 1)
+	server := &http.Server{
+		Handler:           oauthCallbackHandler(state, callbacks),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() { _ = server.Serve(listener) }()
+	defer server.Close()
+
+	authURL, err := c.makeURL(oauthAuthorizePath)
+	if err != nil {
+		return errors.Wrap(err, "failed to make url")
+	}
+	authURL += "?" + url.Values{
+		"response_type":         {"code"},
+		"client_id":             {oauthClientID},
+		"redirect_uri":          {redirectURI},
+		"state":                 {state},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}.Encode()
+	if err := opts.OpenURL(authURL); err != nil {
+		return errors.Wrap(err, "failed to open authorization page")
+	}
+
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = defaultWebLoginTimeout
+	}
+	var callback oauthCallback
+	select {
+	case callback = <-callbacks:
+	case <-time.After(timeout):
+		return errors.Errorf("login was not authorized within %s", timeout)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if callback.err != nil {
+		return callback.err
+	}
+
+	resp := struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int64  `json:"expires_in"`
+	}{}
+	err = c.postForm(ctx, oauthTokenPath, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {callback.code},
+		"redirect_uri":  {redirectURI},
+		"client_id":     {oauthClientID},
+		"code_verifier": {verifier},
+	}, &resp)
+	if err != nil {
+		return errors.Wrap(err, "failed to exchange authorization code")
+	}
+	if resp.AccessToken == "" {
+		return errors.New("failed to exchange authorization code: no access token returned")
+	}
+
+	token := &config.Token{
+		AccessToken:  resp.AccessToken,
+		RefreshToken: resp.RefreshToken,
+	}
+	// expires_in is optional, without it the expiry is unknown
+	if resp.ExpiresIn > 0 {
+		token.ExpiresAt = time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second)
+	}
+	// NOTE: should not write config here, in login command instead
+	c.setToken(token)
+	return nil
+}
+
+// oauthCallbackHandler passes the first authorization response with the
+// expected state to callbacks.
+func oauthCallbackHandler(state string, callbacks chan<- oauthCallback) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != oauthCallbackPath {
+			http.NotFound(w, r)
+			return
+		}
+		query := r.URL.Query()
+		if query.Get("state") != state {
+			http.Error(w, "invalid state, please retry `bendsql cloud login --web`", http.StatusBadRequest)
+			return
+		}
+		var callback oauthCallback
+		if e := query.Get("error"); e != "" {
+			if d := query.Get("error_description"); d != "" {
+				e += ": " + d
+			}
+			callback.err = errors.Errorf("login was not authorized: %s", e)
+			fmt.Fprintln(w, "Login failed, please return to the terminal.")
+		} else if callback.code = query.Get("code"); callback.code == "" {
+			callback.err = errors.New("login failed: no authorization code in the response")
+			http.Error(w, "Login failed, no authorization code in the response, please return to the terminal.", http.StatusBadRequest)
+		} else {
+			fmt.Fprintln(w, "Login succeeded, you can close this window and return to the terminal.")
+		}
+		select {
+		case callbacks <- callback:
+		default:
+		}
+	})
+}
+
+// postForm posts a form as OAuth token endpoints expect and decodes the JSON response.
+func (c *Client) postForm(ctx context.Context, path string, form url.Values, resp interface{}) error {
+	u, err := c.makeURL(path)
+	if err != nil {
+		return errors.Wrap(err, "failed to make url")
+	}
+	var body []byte
+	err = c.retry.do(ctx, false, func() error {
+		httpReq, err := http.NewRequestWithContext(ctx, "POST", u, strings.NewReader(form.Encode()))
+		if err != nil {
+			return retry.Unrecoverable(errors.Wrap(err, "failed to create http request"))
+		}
+		httpReq.Header.Set(contentType, "application/x-www-form-urlencoded")
+		httpReq.Header.Set(accept, jsonContentType)
+
+		httpResp, err := c.httpClient.Do(httpReq)
+		if err != nil {
+			c.logf("POST %s: %v", path, err)
+			return errors.Wrap(err, "http request error")
+		}
+		defer httpResp.Body.Close()
+		c.logf("POST %s: %s", path, httpResp.Status)
+		body, err = io.ReadAll(httpResp.Body)
+		if err != nil {
+			return errors.Wrap(err, "failed to read http response body")
+		}
+		if httpResp.StatusCode >= 400 {
+			return withRetryAfter(dc.NewAPIError("please retry `bendsql cloud login --web`.", httpResp.StatusCode, body), httpResp)
+		}
+		return nil
+	})
+	if err != nil {
+		return wrapError(err)
+	}
+	return errors.Wrap(json.Unmarshal(body, resp), "failed to unmarshal http response body")
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "failed to generate random string")
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,136 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/databendcloud/bendsql/internal/config"
+)
+
+// authServer is a stand-in authorization server that approves every request,
+// the tokens it issues expire in expiresIn seconds.
+func authServer(t *testing.T, expiresIn int) *httptest.Server {
+	var challenge, redirectURI string
+	mux := http.NewServeMux()
+	mux.HandleFunc(oauthAuthorizePath, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		assert.Equal(t, "code", q.Get("response_type"))
+		assert.Equal(t, "S256", q.Get("code_challenge_method"))
+		challenge = q.Get("code_challenge")
+		redirectURI = q.Get("redirect_uri")
+		back := redirectURI + "?" + url.Values{"code": {"the-code"}, "state": {q.Get("state")}}.Encode()
+		http.Redirect(w, r, back, http.StatusFound)
+	})
+	mux.HandleFunc(oauthTokenPath, func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, "authorization_code", r.PostForm.Get("grant_type"))
+		assert.Equal(t, "the-code", r.PostForm.Get("code"))
+		assert.Equal(t, redirectURI, r.PostForm.Get("redirect_uri"))
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if base64.RawURLEncoding.EncodeToString(sum[:]) != challenge {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "access",
+			"refresh_token": "refresh",
+			"expires_in":    expiresIn,
+		})
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTestClient(t *testing.T, endpoint string) *Client {
+	cfg := &config.Config{Profiles: map[string]*config.Profile{
+		config.DefaultProfile: {Target: config.TARGET_CLOUD, Cloud: &config.CloudConfig{Endpoint: endpoint}},
+	}}
+	c, err := NewClient(cfg)
+	assert.NoError(t, err)
+	return c
+}
+
+// followRedirects opens u like a browser, following the redirect to the
+// callback server.
+func followRedirects(u string) error {
+	resp, err := http.Get(u)
+	if err == nil {
+		resp.Body.Close()
+	}
+	return err
+}
+
+func TestLoginWeb(t *testing.T) {
+	srv := authServer(t, 3600)
+	c := newTestClient(t, srv.URL)
+
+	err := c.LoginWeb(context.Background(), WebLoginOptions{OpenURL: followRedirects, Timeout: 5 * time.Second})
+	assert.NoError(t, err)
+	token, err := c.currentToken()
+	assert.NoError(t, err)
+	assert.Equal(t, "access", token.AccessToken)
+	assert.Equal(t, "refresh", token.RefreshToken)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), token.ExpiresAt, time.Minute)
+}
+
+func TestLoginWebUnknownExpiry(t *testing.T) {
+	srv := authServer(t, 0)
+	c := newTestClient(t, srv.URL)
+
+	err := c.LoginWeb(context.Background(), WebLoginOptions{OpenURL: followRedirects, Timeout: 5 * time.Second})
+	assert.NoError(t, err)
+	token, err := c.currentToken()
+	assert.NoError(t, err)
+	assert.True(t, token.ExpiresAt.IsZero())
+	assert.False(t, token.NeedsRefresh())
+}
+
+func TestLoginWebNoCode(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		back := q.Get("redirect_uri") + "?" + url.Values{"state": {q.Get("state")}}.Encode()
+		http.Redirect(w, r, back, http.StatusFound)
+	}))
+	defer srv.Close()
+	c := newTestClient(t, srv.URL)
+
+	err := c.LoginWeb(context.Background(), WebLoginOptions{OpenURL: followRedirects, Timeout: 5 * time.Second})
+	assert.EqualError(t, err, "login failed: no authorization code in the response")
+}
+
+func TestLoginWebDenied(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		back := q.Get("redirect_uri") + "?" + url.Values{"error": {"access_denied"}, "state": {q.Get("state")}}.Encode()
+		http.Redirect(w, r, back, http.StatusFound)
+	}))
+	defer srv.Close()
+	c := newTestClient(t, srv.URL)
+
+	err := c.LoginWeb(context.Background(), WebLoginOptions{OpenURL: followRedirects, Timeout: 5 * time.Second})
+	assert.EqualError(t, err, "login was not authorized: access_denied")
+}
@@ -0,0 +1,154 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/pkg/errors"
+
+	"github.com/databendcloud/bendsql/internal/config"
+)
+
+// TokenSource supplies the access tokens of a Client created with New, e.g.
+// from a secret manager. It is asked before every request, so it should
+// cache tokens until they are about to expire.
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// StaticToken is a TokenSource of an API key or personal access token.
+type StaticToken string
+
+func (t StaticToken) Token(ctx context.Context) (string, error) {
+	return string(t), nil
+}
+
+// Logger receives a line for every request, *log.Logger and logrus loggers
+// satisfy it.
+type Logger interface {
+	Printf(format string, args ...interface{})
+}
+
+// Option configures a Client created with New.
+type Option func(*Client)
+
+// WithEndpoint sets the Databend Cloud endpoint, EndpointGlobal by default.
+func WithEndpoint(endpoint string) Option {
+	return func(c *Client) {
+		c.cfg.Endpoint = endpoint
+	}
+}
+
+// WithOrg sets the organization warehouses are managed and queried in.
+func WithOrg(org string) Option {
+	return func(c *Client) {
+		c.cfg.Org = org
+	}
+}
+
+// WithWarehouse sets the warehouse of GetCloudDSN.
+func WithWarehouse(warehouse string) Option {
+	return func(c *Client) {
+		c.cfg.Warehouse = warehouse
+	}
+}
+
+// WithTokenSource authenticates requests with tokens of ts instead of
+// signing in with Login.
+func WithTokenSource(ts TokenSource) Option {
+	return func(c *Client) {
+		c.tokenSource = ts
+	}
+}
+
+// WithHTTPClient sends all requests including uploads with hc.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = hc
+		c.uploadClient = hc
+	}
+}
+
+// WithLogger logs every request to l.
+func WithLogger(l Logger) Option {
+	return func(c *Client) {
+		c.logger = l
+	}
+}
+
+// WithPaging sets how query results are paged, DefaultPagingOptions by
+// default.
+func WithPaging(p PagingOptions) Option {
+	return func(c *Client) {
+		c.paging = p
+	}
+}
+
+// WithTransportOptions sets the timeout, proxy and tracing of requests,
+// ignored with WithHTTPClient. Requests time out after DefaultTimeout by
+// default.
+func WithTransportOptions(opts TransportOptions) Option {
+	return func(c *Client) {
+		c.transportOpts = opts
+	}
+}
+
+// WithRetryPolicy sets how failed requests are retried, zero fields of p
+// keep their value of DefaultRetryPolicy.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = DefaultRetryPolicy.override(p)
+	}
+}
+
+// New returns a client for Go programs embedding bendsql. Unlike NewClient
+// it never reads or writes config.toml and ignores the BENDSQL_*
+// environment variables and the global flags, everything is set by opts.
+func New(opts ...Option) (*Client, error) {
+	cfg := &config.CloudConfig{Endpoint: EndpointGlobal}
+	c := &Client{
+		cfg:           cfg,
+		base:          cfg,
+		retry:         DefaultRetryPolicy,
+		paging:        DefaultPagingOptions,
+		standalone:    true,
+		transportOpts: TransportOptions{Timeout: DefaultTimeout},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.httpClient == nil {
+		transport, err := newTransport(c.transportOpts)
+		if err != nil {
+			return nil, err
+		}
+		c.httpClient = &http.Client{Transport: transport, Timeout: c.transportOpts.Timeout}
+		c.uploadClient = &http.Client{Transport: transport}
+	}
+	if _, err := config.ParseEndpoint(c.cfg.Endpoint); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Client) logf(format string, args ...interface{}) {
+	if c.logger != nil {
+		c.logger.Printf(format, args...)
+	}
+}
+
+var errStandalone = errors.New("the client was not created from config.toml")
@@ -0,0 +1,99 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testLogger struct {
+	lines []string
+}
+
+func (l *testLogger) Printf(format string, args ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, args...))
+}
+
+func TestNew(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer api-key", r.Header.Get("Authorization"))
+		assert.Equal(t, "/api/v1/orgs/databend/tenant/warehouses", r.URL.Path)
+		_, _ = w.Write([]byte(`{"data":[{"name":"w1"}]}`))
+	}))
+	defer srv.Close()
+
+	// neither config.toml nor the environment are used
+	t.Setenv("BENDSQL_CONFIG", "/nonexistent/config.toml")
+	t.Setenv("BENDSQL_API_ENDPOINT", "http://127.0.0.1:1")
+	t.Setenv("BENDSQL_TOKEN", "env-token")
+	logger := &testLogger{}
+	c, err := New(
+		WithEndpoint(srv.URL),
+		WithOrg("databend"),
+		WithTokenSource(StaticToken("api-key")),
+		WithHTTPClient(srv.Client()),
+		WithLogger(logger),
+	)
+	assert.NoError(t, err)
+	var api CloudAPI = c
+	warehouses, err := api.ListWarehouses(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, warehouses, 1)
+	assert.Len(t, logger.lines, 1)
+	assert.True(t, strings.HasPrefix(logger.lines[0], "GET /api/v1/orgs/databend/tenant/warehouses: 200 OK"))
+	assert.ErrorIs(t, c.WriteConfig(), errStandalone)
+
+	_, err = New(WithEndpoint("app.databend.com"))
+	assert.Error(t, err)
+}
+
+func TestNewIgnoresGlobalFlags(t *testing.T) {
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	assert.NoError(t, SetTransportOptions(TransportOptions{Proxy: "http://127.0.0.1:1"}))
+	SetRetryPolicy(RetryPolicy{Attempts: 5})
+	defer func() {
+		_ = SetTransportOptions(TransportOptions{Timeout: DefaultTimeout})
+		SetRetryPolicy(RetryPolicy{})
+	}()
+
+	c, err := New(
+		WithEndpoint(srv.URL),
+		WithOrg("databend"),
+		WithTokenSource(StaticToken("api-key")),
+		WithRetryPolicy(RetryPolicy{Attempts: 2, Delay: time.Millisecond}),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultRetryPolicy.MaxElapsed, c.retry.MaxElapsed)
+	_, err = c.ListWarehouses(context.Background())
+	assert.Error(t, err)
+	assert.Equal(t, 2, attempts, "the proxy and retries of the flags must not be used")
+
+	_, err = New(WithTransportOptions(TransportOptions{Proxy: "ftp://proxy"}))
+	assert.EqualError(t, err, "invalid proxy ftp://proxy, expected an http, https, socks5 or socks5h URL")
+}
@@ -0,0 +1,304 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+
+	dc "github.com/databendcloud/databend-go"
+	"github.com/pkg/errors"
+)
+
+// StopTimeout bounds the request stopping a cancelled query on the server.
+const StopTimeout = 5 * time.Second
+
+// QueryCancelledError is returned when the context of a query is cancelled,
+// after the query was stopped on the server.
+type QueryCancelledError struct {
+	// ID is empty if the query was cancelled before the server assigned one.
+	ID string
+	// StopErr is why the query could not be stopped, it may still run. It is
+	// errQueryIDUnknown when the query was cancelled before its ID was known.
+	StopErr error
+	Err     error
+}
+
+func (e *QueryCancelledError) Error() string {
+	msg := "query cancelled"
+	if e.ID != "" {
+		msg = fmt.Sprintf("query %s cancelled", e.ID)
+	}
+	if e.StopErr != nil {
+		msg += fmt.Sprintf(", but it may still be running on the server: %v", e.StopErr)
+	}
+	return msg
+}
+
+func (e *QueryCancelledError) Unwrap() error {
+	return e.Err
+}
+
+// errQueryIDUnknown is the StopErr of queries cancelled before the server
+// returned their ID, they can not be stopped.
+var errQueryIDUnknown = errors.New("query ID unknown")
+
+// cancelStarted returns the error of a query cancelled while it was started,
+// first is the response starting it if there was one. Queries with an ID are
+// stopped on the server.
+func cancelStarted(first *dc.QueryResponse, fetch PageFetcher, err error) error {
+	if first == nil || first.Id == "" {
+		return &QueryCancelledError{StopErr: errQueryIDUnknown, Err: err}
+	}
+	return NewPages(first, fetch).cancel(err)
+}
+
+func isCancelled(err error) bool {
+	var cancelled *QueryCancelledError
+	return errors.As(err, &cancelled)
+}
+
+// PagingOptions tune how the pages of query results are fetched.
+type PagingOptions struct {
+	// Prefetch is how many pages are fetched in the background while the
+	// reader processes the current one, 0 fetches each page when it is read.
+	Prefetch int
+	// MaxPrefetchBytes caps the data of the prefetched pages, a page is
+	// prefetched whatever its size. 0 means no cap.
+	MaxPrefetchBytes int64
+	// DisableCompression stops asking for gzip compressed pages.
+	DisableCompression bool
+}
+
+// DefaultPagingOptions prefetch two pages holding up to 64 MiB.
+var DefaultPagingOptions = PagingOptions{Prefetch: 2, MaxPrefetchBytes: 64 << 20}
+
+// PageFetcher fetches the query page at uri, such as a next_uri or the
+// final_uri of a query.
+type PageFetcher func(ctx context.Context, uri string) (*dc.QueryResponse, error)
+
+// Pages iterates the pages of a query. When the context of Next is
+// cancelled the query is stopped through its final_uri, as does Close
+// before the last page.
+type Pages struct {
+	fetch    PageFetcher
+	id       string
+	finalURI string
+	first    *dc.QueryResponse
+	nextURI  string
+	done     bool
+
+	prefetch int
+	maxBytes int64
+	ahead    *prefetcher
+}
+
+// NewPages returns the pages of the query whose first response is first.
+func NewPages(first *dc.QueryResponse, fetch PageFetcher) *Pages {
+	finalURI := first.FinalURI
+	if finalURI == "" {
+		finalURI = fmt.Sprintf("/v1/query/%s/kill", first.Id)
+	}
+	return &Pages{
+		fetch:    fetch,
+		id:       first.Id,
+		finalURI: finalURI,
+		first:    first,
+	}
+}
+
+// Prefetch makes Next fetch up to n pages ahead of the reader, holding at
+// most maxBytes of data unless a single page is larger. The pages are
+// fetched with the context of the Next call returning the first page, so it
+// should be the context of all calls. Prefetch must be called before Next.
+func (p *Pages) Prefetch(n int, maxBytes int64) {
+	p.prefetch = n
+	p.maxBytes = maxBytes
+}
+
+// ID returns the query ID.
+func (p *Pages) ID() string {
+	return p.id
+}
+
+// Next returns the next page, starting with the first response, or io.EOF
+// after the last one.
+func (p *Pages) Next(ctx context.Context) (*dc.QueryResponse, error) {
+	if p.done {
+		return nil, io.EOF
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, p.cancel(err)
+	}
+	page := p.first
+	if page != nil {
+		p.first = nil
+	} else {
+		var err error
+		if p.ahead != nil {
+			page, err = p.ahead.next(ctx)
+		} else {
+			page, err = p.fetch(ctx, p.nextURI)
+		}
+		if ctx.Err() != nil {
+			return nil, p.cancel(ctx.Err())
+		} else if err != nil {
+			p.done = true
+			return nil, err
+		}
+	}
+	if page.Error != nil {
+		p.done = true
+		return nil, wrapError(page.Error)
+	}
+	p.nextURI = page.NextURI
+	p.done = p.nextURI == ""
+	if !p.done && p.prefetch > 0 && p.ahead == nil {
+		p.ahead = startPrefetch(ctx, p.fetch, p.nextURI, p.prefetch, p.maxBytes)
+	}
+	return page, nil
+}
+
+// Close stops the query on the server unless all pages were fetched.
+func (p *Pages) Close() error {
+	if p.ahead != nil {
+		p.ahead.stop()
+	}
+	if p.done {
+		return nil
+	}
+	p.done = true
+	return p.stop()
+}
+
+func (p *Pages) cancel(err error) error {
+	cancelled := &QueryCancelledError{ID: p.id, Err: err}
+	if p.ahead != nil {
+		p.ahead.stop()
+	}
+	if !p.done {
+		p.done = true
+		cancelled.StopErr = p.stop()
+	}
+	return cancelled
+}
+
+// stop calls the final_uri, the context of the query may be cancelled by
+// now so the request has its own.
+func (p *Pages) stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), StopTimeout)
+	defer cancel()
+	_, err := p.fetch(ctx, p.finalURI)
+	return err
+}
+
+type prefetched struct {
+	page *dc.QueryResponse
+	size int64
+	err  error
+}
+
+// prefetcher fetches pages ahead of the reader of Pages, following their
+// next_uri as long as fewer than cap(pages) pages and maxBytes of data are
+// waiting to be read.
+type prefetcher struct {
+	// buffered is first to be aligned for atomic access on 32-bit platforms
+	buffered int64
+	maxBytes int64
+	ctx      context.Context
+	cancel   context.CancelFunc
+	pages    chan prefetched
+	consumed chan struct{}
+}
+
+func startPrefetch(ctx context.Context, fetch PageFetcher, uri string, n int, maxBytes int64) *prefetcher {
+	ctx, cancel := context.WithCancel(ctx)
+	f := &prefetcher{
+		ctx:      ctx,
+		cancel:   cancel,
+		pages:    make(chan prefetched, n),
+		consumed: make(chan struct{}, 1),
+		maxBytes: maxBytes,
+	}
+	go f.run(fetch, uri)
+	return f
+}
+
+func (f *prefetcher) run(fetch PageFetcher, uri string) {
+	defer close(f.pages)
+	for uri != "" {
+		for f.maxBytes > 0 && atomic.LoadInt64(&f.buffered) >= f.maxBytes {
+			select {
+			case <-f.consumed:
+			case <-f.ctx.Done():
+				return
+			}
+		}
+		page, err := fetch(f.ctx, uri)
+		r := prefetched{page: page, err: err}
+		if err == nil {
+			r.size = pageSize(page)
+			atomic.AddInt64(&f.buffered, r.size)
+		}
+		select {
+		case f.pages <- r:
+		case <-f.ctx.Done():
+			return
+		}
+		if err != nil || page.Error != nil {
+			return
+		}
+		uri = page.NextURI
+	}
+}
+
+// next returns the next page once it is fetched.
+func (f *prefetcher) next(ctx context.Context) (*dc.QueryResponse, error) {
+	select {
+	case r, ok := <-f.pages:
+		if !ok {
+			return nil, errors.Wrap(f.ctx.Err(), "prefetching pages stopped")
+		}
+		atomic.AddInt64(&f.buffered, -r.size)
+		select {
+		case f.consumed <- struct{}{}:
+		default:
+		}
+		return r.page, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// stop cancels the fetch in flight and waits for the prefetcher to exit.
+func (f *prefetcher) stop() {
+	f.cancel()
+	for range f.pages {
+	}
+}
+
+// pageSize estimates the memory held by the data of page.
+func pageSize(page *dc.QueryResponse) int64 {
+	var n int64
+	for _, row := range page.Data {
+		for _, v := range row {
+			n += int64(len(v))
+		}
+	}
+	return n
+}
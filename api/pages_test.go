@@ -0,0 +1,190 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	dc "github.com/databendcloud/databend-go"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakePages serves the pages of query q1, the first one is the response to
+// the query and the others are at /page/1, /page/2 and so on.
+type fakePages struct {
+	mu      sync.Mutex
+	data    [][][]string
+	fetched []string
+}
+
+func (f *fakePages) page(n int) *dc.QueryResponse {
+	resp := &dc.QueryResponse{Id: "q1", Data: f.data[n], FinalURI: "/final"}
+	if n < len(f.data)-1 {
+		resp.NextURI = fmt.Sprintf("/page/%d", n+1)
+	}
+	return resp
+}
+
+func (f *fakePages) fetch(ctx context.Context, uri string) (*dc.QueryResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fetched = append(f.fetched, uri)
+	if uri == "/final" {
+		return &dc.QueryResponse{Id: "q1"}, nil
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(uri, "/page/"))
+	if err != nil {
+		return nil, err
+	}
+	return f.page(n), nil
+}
+
+func TestPages(t *testing.T) {
+	f := &fakePages{data: [][][]string{{{"1"}}, {}, {{"2"}, {"3"}}}}
+	pages := NewPages(f.page(0), f.fetch)
+	assert.Equal(t, "q1", pages.ID())
+	var rows [][]string
+	for {
+		page, err := pages.Next(context.Background())
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		rows = append(rows, page.Data...)
+	}
+	assert.Equal(t, [][]string{{"1"}, {"2"}, {"3"}}, rows)
+	assert.NoError(t, pages.Close())
+	assert.Equal(t, []string{"/page/1", "/page/2"}, f.fetched)
+}
+
+func TestPagesClose(t *testing.T) {
+	f := &fakePages{data: [][][]string{{{"1"}}, {{"2"}}}}
+	pages := NewPages(f.page(0), f.fetch)
+	_, err := pages.Next(context.Background())
+	assert.NoError(t, err)
+	assert.NoError(t, pages.Close())
+	assert.NoError(t, pages.Close())
+	assert.Equal(t, []string{"/final"}, f.fetched)
+}
+
+func TestPagesCancel(t *testing.T) {
+	f := &fakePages{data: [][][]string{{{"1"}}, {{"2"}}}}
+	pages := NewPages(f.page(0), f.fetch)
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err := pages.Next(ctx)
+	assert.NoError(t, err)
+	cancel()
+
+	_, err = pages.Next(ctx)
+	var cancelled *QueryCancelledError
+	if assert.ErrorAs(t, err, &cancelled) {
+		assert.Equal(t, "q1", cancelled.ID)
+		assert.NoError(t, cancelled.StopErr)
+	}
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.EqualError(t, err, "query q1 cancelled")
+	_, err = pages.Next(ctx)
+	assert.Equal(t, io.EOF, err)
+	assert.NoError(t, pages.Close())
+	assert.Equal(t, []string{"/final"}, f.fetched)
+
+	stopErr := &QueryCancelledError{ID: "q1", StopErr: errors.New("timeout"), Err: context.Canceled}
+	assert.EqualError(t, stopErr, "query q1 cancelled, but it may still be running on the server: timeout")
+}
+
+func TestCancelStarted(t *testing.T) {
+	f := &fakePages{data: [][][]string{{{"1"}}, {{"2"}}}}
+	err := cancelStarted(nil, f.fetch, context.Canceled)
+	assert.EqualError(t, err, "query cancelled, but it may still be running on the server: query ID unknown")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Empty(t, f.fetched)
+
+	// the query is stopped once its ID is known
+	err = cancelStarted(f.page(0), f.fetch, context.Canceled)
+	assert.EqualError(t, err, "query q1 cancelled")
+	assert.Equal(t, []string{"/final"}, f.fetched)
+}
+
+func (f *fakePages) fetches() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.fetched...)
+}
+
+func TestPagesPrefetch(t *testing.T) {
+	f := &fakePages{data: [][][]string{{{"1"}}, {{"2"}}, {{"3"}}, {{"4"}}, {{"5"}}, {{"6"}}}}
+	pages := NewPages(f.page(0), f.fetch)
+	pages.Prefetch(2, 0)
+	ctx := context.Background()
+	_, err := pages.Next(ctx)
+	assert.NoError(t, err)
+
+	// two pages wait to be read and a third one to be queued
+	assert.Eventually(t, func() bool { return len(f.fetches()) == 3 }, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, []string{"/page/1", "/page/2", "/page/3"}, f.fetches())
+
+	var rows []string
+	for {
+		page, err := pages.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		rows = append(rows, page.Data[0][0])
+	}
+	assert.Equal(t, []string{"2", "3", "4", "5", "6"}, rows)
+	assert.NoError(t, pages.Close())
+	assert.Len(t, f.fetches(), 5)
+}
+
+func TestPagesPrefetchMaxBytes(t *testing.T) {
+	f := &fakePages{data: [][][]string{{{"1"}}, {{"22"}}, {{"33"}}, {{"44"}}}}
+	pages := NewPages(f.page(0), f.fetch)
+	pages.Prefetch(10, 2)
+	ctx := context.Background()
+	_, err := pages.Next(ctx)
+	assert.NoError(t, err)
+
+	// a page fills the cap, the next is fetched once it is read
+	assert.Eventually(t, func() bool { return len(f.fetches()) == 1 }, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	assert.Len(t, f.fetches(), 1)
+	_, err = pages.Next(ctx)
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool { return len(f.fetches()) == 2 }, time.Second, time.Millisecond)
+
+	// closing stops prefetching and the query
+	assert.NoError(t, pages.Close())
+	assert.Equal(t, []string{"/page/1", "/page/2", "/final"}, f.fetches())
+}
+
+func TestPagesQueryError(t *testing.T) {
+	first := &dc.QueryResponse{Id: "q1", Error: &dc.QueryError{Code: 1025, Message: "Unknown table"}}
+	pages := NewPages(first, nil)
+	_, err := pages.Next(context.Background())
+	if e := AsError(err); assert.NotNil(t, e) {
+		assert.Equal(t, ErrorQuery, e.Kind)
+	}
+	assert.NoError(t, pages.Close())
+}
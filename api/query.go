@@ -15,16 +15,17 @@
 package api
 
 import (
+	"context"
+	"io"
 	"net/http"
-	"strings"
-	"time"
 
 	"github.com/avast/retry-go"
 	dc "github.com/databendcloud/databend-go"
 	"github.com/pkg/errors"
 )
 
-func (c *Client) Query(warehouseName, query string) (*dc.QueryResponse, error) {
+// Query starts a query, it is sent again while the warehouse is provisioning.
+func (c *Client) Query(ctx context.Context, warehouseName, query string) (*dc.QueryResponse, error) {
 	headers := make(http.Header)
 	headers.Set("X-DATABENDCLOUD-WAREHOUSE", warehouseName)
 	headers.Set("X-DATABENDCLOUD-ORG", string(c.cfg.Org))
@@ -33,81 +34,84 @@ func (c *Client) Query(warehouseName, query string) (*dc.QueryResponse, error) {
 	}
 	path := "/v1/query"
 	var result dc.QueryResponse
-	err := c.DoRequest("POST", path, headers, request, &result)
-	if err != nil {
+	err := c.retry.do(ctx, false, func() error {
+		result = dc.QueryResponse{}
+		err := c.DoRequest(ctx, "POST", path, headers, request, &result)
+		if err != nil {
+			// already retried by DoRequest
+			return retry.Unrecoverable(err)
+		}
+		if result.Error != nil {
+			return wrapError(errors.Wrapf(result.Error, "query %s in org %s", warehouseName, c.cfg.Org))
+		}
+		return nil
+	})
+	if ctx.Err() != nil {
+		// the response may have arrived just before ctx was cancelled
+		return nil, cancelStarted(&result, c.pageFetcher(warehouseName, result.Id), ctx.Err())
+	} else if err != nil && result.Error != nil {
+		return &result, err
+	} else if err != nil {
 		return nil, err
 	}
-	if result.Error != nil {
-		return &result, errors.Wrapf(result.Error, "query %s in org %s: %s", warehouseName, c.cfg.Org)
-	}
 	return &result, nil
 }
 
-func (c *Client) QuerySync(warehouseName string, sql string, respCh chan dc.QueryResponse) error {
-	var r0 *dc.QueryResponse
-	err := retry.Do(
-		func() error {
-			r, err := c.Query(warehouseName, sql)
-			if err != nil {
-				return errors.Wrap(err, "query failed")
-			}
-			r0 = r
-			return nil
-		},
-		// other err no need to retry
-		retry.RetryIf(func(err error) bool {
-			if err != nil && !(dc.IsProxyErr(err) || strings.Contains(err.Error(), dc.ProvisionWarehouseTimeout)) {
-				return false
-			}
-			return true
-		}),
-		retry.Delay(2*time.Second),
-		retry.Attempts(10),
-	)
+// QuerySync runs a query and sends its pages to respCh. When ctx is
+// cancelled the query is stopped on the server and a *QueryCancelledError
+// is returned.
+//
+// Deprecated: use QueryRows, which decodes the values and needs no reader
+// of a channel.
+func (c *Client) QuerySync(ctx context.Context, warehouseName string, sql string, respCh chan dc.QueryResponse) error {
+	r0, err := c.Query(ctx, warehouseName, sql)
 	if err != nil {
 		return errors.Wrap(err, "query failed")
 	}
-	if r0.Error != nil {
-		return errors.Wrap(r0.Error, "query has error")
-	}
-	if err != nil {
-		return err
-	}
-	respCh <- *r0
-	nextUri := r0.NextURI
-	for len(nextUri) != 0 {
-		p, err := c.QueryPage(warehouseName, r0.Id, nextUri)
-		if err != nil {
+	pages := c.QueryPages(warehouseName, r0)
+	defer pages.Close()
+	for {
+		page, err := pages.Next(ctx)
+		if err == io.EOF {
+			return nil
+		} else if isCancelled(err) {
+			return err
+		} else if err != nil {
 			return errors.Wrap(err, "query page failed")
 		}
-		if p.Error != nil {
-			return errors.Wrap(p.Error, "query has error")
+		select {
+		case respCh <- *page:
+		case <-ctx.Done():
+			// the next call stops the query
 		}
-		nextUri = p.NextURI
-		respCh <- *p
 	}
-	return nil
 }
 
-func (c *Client) QueryPage(warehouseName, queryId, path string) (*dc.QueryResponse, error) {
+// QueryPages returns the pages of a query started by Query, prefetched as
+// set by WithPaging.
+func (c *Client) QueryPages(warehouseName string, first *dc.QueryResponse) *Pages {
+	pages := NewPages(first, c.pageFetcher(warehouseName, first.Id))
+	pages.Prefetch(c.paging.Prefetch, c.paging.MaxPrefetchBytes)
+	return pages
+}
+
+func (c *Client) pageFetcher(warehouseName, queryId string) PageFetcher {
+	return func(ctx context.Context, uri string) (*dc.QueryResponse, error) {
+		return c.QueryPage(ctx, warehouseName, queryId, uri)
+	}
+}
+
+// QueryPage fetches the page at path, failed fetches are retried as the
+// server keeps a page until the next one is requested.
+func (c *Client) QueryPage(ctx context.Context, warehouseName, queryId, path string) (*dc.QueryResponse, error) {
 	headers := make(http.Header)
 	headers.Set("queryID", queryId)
 	headers.Set("X-DATABENDCLOUD-WAREHOUSE", warehouseName)
 	headers.Set("X-DATABENDCLOUD-ORG", string(c.cfg.Org))
 	var result dc.QueryResponse
-	err := retry.Do(
-		func() error {
-			err := c.DoRequest("GET", path, headers, nil, &result)
-			if err != nil {
-				return errors.Wrap(err, "query page failed")
-			}
-			return nil
-		},
-		retry.Delay(2*time.Second),
-		retry.Attempts(10),
-	)
+	err := c.DoRequest(ctx, "GET", path, headers, nil, &result)
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrap(err, "query page failed")
 	}
 	return &result, nil
 }
@@ -0,0 +1,240 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/avast/retry-go"
+	dc "github.com/databendcloud/databend-go"
+	"github.com/pkg/errors"
+
+	"github.com/databendcloud/bendsql/internal/config"
+)
+
+// RetryPolicy decides how often and how long failed requests are retried.
+// Requests are only retried when sending them again can not apply them
+// twice: requests that never reached the server, requests the server
+// rejected with 429 or while provisioning the warehouse, and requests with
+// idempotent methods failing with network errors or 5xx.
+type RetryPolicy struct {
+	// Attempts is the maximum number of attempts of a request, 1 disables
+	// retries.
+	Attempts uint
+	// Delay is the wait before the first retry, it doubles for every
+	// following retry, with up to half of it as random jitter.
+	Delay time.Duration
+	// MaxDelay caps the wait between two attempts unless the server asks
+	// for a longer one with Retry-After.
+	MaxDelay time.Duration
+	// MaxElapsed is the overall deadline, no attempt starts after it. Zero
+	// means no deadline.
+	MaxElapsed time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts:   5,
+	Delay:      500 * time.Millisecond,
+	MaxDelay:   10 * time.Second,
+	MaxElapsed: 2 * time.Minute,
+}
+
+// retryFlags are set from the global --retry-attempts and
+// --retry-max-elapsed flags, their non-zero fields take precedence over the
+// [retry] table of config.toml.
+var retryFlags RetryPolicy
+
+// SetRetryPolicy sets the non-zero fields of p as overrides of the retry
+// policy of clients created afterwards.
+func SetRetryPolicy(p RetryPolicy) {
+	retryFlags = p
+}
+
+// newRetryPolicy merges the defaults, the [retry] table of config.toml and
+// the flags.
+func newRetryPolicy(cfg *config.RetryConfig) (RetryPolicy, error) {
+	p := DefaultRetryPolicy
+	if cfg != nil {
+		if cfg.Attempts > 0 {
+			p.Attempts = uint(cfg.Attempts)
+		}
+		for _, d := range []struct {
+			value string
+			field *time.Duration
+		}{
+			{cfg.Delay, &p.Delay},
+			{cfg.MaxDelay, &p.MaxDelay},
+			{cfg.MaxElapsed, &p.MaxElapsed},
+		} {
+			if d.value == "" {
+				continue
+			}
+			duration, err := time.ParseDuration(d.value)
+			if err != nil {
+				return p, errors.Wrapf(err, "invalid retry duration %q in config", d.value)
+			}
+			*d.field = duration
+		}
+	}
+	return p.override(retryFlags), nil
+}
+
+// override returns p with the non-zero fields of o.
+func (p RetryPolicy) override(o RetryPolicy) RetryPolicy {
+	if o.Attempts > 0 {
+		p.Attempts = o.Attempts
+	}
+	if o.Delay > 0 {
+		p.Delay = o.Delay
+	}
+	if o.MaxDelay > 0 {
+		p.MaxDelay = o.MaxDelay
+	}
+	if o.MaxElapsed > 0 {
+		p.MaxElapsed = o.MaxElapsed
+	}
+	return p
+}
+
+// backoff returns the wait before retry n, counted from 0.
+func (p RetryPolicy) backoff(n uint) time.Duration {
+	delay := p.Delay
+	for i := uint(0); i < n && (p.MaxDelay <= 0 || delay < p.MaxDelay); i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 1 {
+		return delay
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)))
+}
+
+// do calls fn until it succeeds, fails with an error that is not retryable
+// or the policy is exhausted. Errors wrapped with retry.Unrecoverable are
+// returned at once.
+func (p RetryPolicy) do(ctx context.Context, idempotent bool, fn func() error) error {
+	start := time.Now()
+	var n uint
+	var delay time.Duration
+	attempts := p.Attempts
+	if attempts == 0 {
+		attempts = 1
+	}
+	return retry.Do(
+		fn,
+		retry.RetryIf(func(err error) bool {
+			if ctx.Err() != nil || !retry.IsRecoverable(err) || !isRetryable(err, idempotent) {
+				return false
+			}
+			delay = p.backoff(n)
+			n++
+			if after := retryAfter(err); after > 0 {
+				delay = after
+			}
+			return p.MaxElapsed <= 0 || time.Since(start)+delay < p.MaxElapsed
+		}),
+		retry.DelayType(func(uint, error, *retry.Config) time.Duration {
+			return delay
+		}),
+		retry.Context(ctx),
+		retry.Attempts(attempts),
+		retry.LastErrorOnly(true),
+	)
+}
+
+// isRetryable reports whether a request failing with err may be sent again.
+func isRetryable(err error, idempotent bool) bool {
+	if strings.Contains(err.Error(), dc.ProvisionWarehouseTimeout) {
+		return true
+	}
+	var apiErr dc.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusTooManyRequests:
+			return true
+		case 520:
+			// the gateway could not reach the warehouse, e.g. while it resumes
+			return true
+		case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return idempotent
+		}
+		return false
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		// the request was never sent
+		return true
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr) && idempotent
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "PUT", "DELETE":
+		return true
+	}
+	return false
+}
+
+// retryAfterError carries the wait the server asked for with Retry-After.
+type retryAfterError struct {
+	err   error
+	after time.Duration
+}
+
+func (e *retryAfterError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryAfterError) Unwrap() error {
+	return e.err
+}
+
+func retryAfter(err error) time.Duration {
+	var e *retryAfterError
+	if errors.As(err, &e) {
+		return e.after
+	}
+	return 0
+}
+
+// withRetryAfter attaches the Retry-After header of a 429 or 503 response
+// to err.
+func withRetryAfter(err error, resp *http.Response) error {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return err
+	}
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return err
+	}
+	if seconds, parseErr := strconv.Atoi(value); parseErr == nil && seconds >= 0 {
+		return &retryAfterError{err: err, after: time.Duration(seconds) * time.Second}
+	}
+	if t, parseErr := http.ParseTime(value); parseErr == nil {
+		return &retryAfterError{err: err, after: time.Until(t)}
+	}
+	return err
+}
@@ -0,0 +1,143 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	dc "github.com/databendcloud/databend-go"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/databendcloud/bendsql/internal/config"
+)
+
+func TestRetryPolicyMerge(t *testing.T) {
+	p, err := newRetryPolicy(&config.RetryConfig{Attempts: 3, MaxElapsed: "10s"})
+	assert.NoError(t, err)
+	assert.Equal(t, RetryPolicy{Attempts: 3, Delay: DefaultRetryPolicy.Delay, MaxDelay: DefaultRetryPolicy.MaxDelay, MaxElapsed: 10 * time.Second}, p)
+
+	SetRetryPolicy(RetryPolicy{Attempts: 1})
+	defer SetRetryPolicy(RetryPolicy{})
+	p, err = newRetryPolicy(&config.RetryConfig{Attempts: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), p.Attempts)
+
+	for n := uint(0); n < 10; n++ {
+		d := DefaultRetryPolicy.backoff(n)
+		assert.LessOrEqual(t, d, DefaultRetryPolicy.MaxDelay)
+		assert.GreaterOrEqual(t, d, DefaultRetryPolicy.Delay/2)
+	}
+}
+
+func TestRetryStatus(t *testing.T) {
+	var attempts int32
+	status := http.StatusServiceUnavailable
+	retryAfter := ""
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.WriteHeader(status)
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":[]}`))
+	}))
+	defer srv.Close()
+
+	SetRetryPolicy(RetryPolicy{Delay: time.Millisecond})
+	defer SetRetryPolicy(RetryPolicy{})
+	c := newTestClient(t, srv.URL)
+	c.LoginWithToken("api-key")
+
+	// idempotent requests are retried on 5xx
+	_, err := c.ListWarehouses(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), attempts)
+
+	// others are not
+	atomic.StoreInt32(&attempts, 0)
+	err = c.SuspendWarehouse(context.Background(), "w1")
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), attempts)
+
+	// but every request is retried on 429
+	atomic.StoreInt32(&attempts, 0)
+	status = http.StatusTooManyRequests
+	retryAfter = "0"
+	assert.NoError(t, c.SuspendWarehouse(context.Background(), "w1"))
+	assert.Equal(t, int32(3), attempts)
+
+	// unless Retry-After is beyond the deadline
+	atomic.StoreInt32(&attempts, 0)
+	retryAfter = "60"
+	c.retry.MaxElapsed = time.Second
+	err = c.SuspendWarehouse(context.Background(), "w1")
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), attempts)
+}
+
+func TestRetryProvisioningQuery(t *testing.T) {
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			_, _ = w.Write([]byte(`{"id":"q1","error":{"code":500,"message":"ProvisionWarehouseTimeout"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":"q1","data":[["1"]]}`))
+	}))
+	defer srv.Close()
+
+	SetRetryPolicy(RetryPolicy{Delay: time.Millisecond})
+	defer SetRetryPolicy(RetryPolicy{})
+	c := newTestClient(t, srv.URL)
+	c.LoginWithToken("api-key")
+	result, err := c.Query(context.Background(), "w1", "select 1")
+	assert.NoError(t, err)
+	assert.Equal(t, "q1", result.Id)
+	assert.Equal(t, int32(2), attempts)
+}
+
+func TestIsRetryable(t *testing.T) {
+	dialErr := &url.Error{Op: "Post", URL: "https://app.databend.com", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}
+	resetErr := &url.Error{Op: "Post", URL: "https://app.databend.com", Err: &net.OpError{Op: "read", Err: errors.New("connection reset by peer")}}
+	tests := []struct {
+		err        error
+		idempotent bool
+		retryable  bool
+	}{
+		{dialErr, false, true},
+		{resetErr, true, true},
+		{resetErr, false, false},
+		{dc.NewAPIError("", http.StatusBadGateway, nil), true, true},
+		{dc.NewAPIError("", http.StatusBadGateway, nil), false, false},
+		{dc.NewAPIError("", 520, nil), false, true},
+		{errors.Wrap(dc.NewAPIError("", http.StatusTooManyRequests, nil), "list warehouses"), false, true},
+		{dc.NewAPIError("", http.StatusBadRequest, nil), true, false},
+		{dc.NewAPIError("", http.StatusUnauthorized, nil), true, false},
+		{errors.New("code: 500, message: ProvisionWarehouseTimeout"), false, true},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.retryable, isRetryable(tt.err, tt.idempotent), "%v idempotent=%v", tt.err, tt.idempotent)
+	}
+}
@@ -0,0 +1,475 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	dc "github.com/databendcloud/databend-go"
+	"github.com/pkg/errors"
+)
+
+// Rows iterates the rows of a query, pulling pages from the server as
+// they are needed. Values are decoded by the types of their columns:
+// integers and floats of their size, Boolean as bool, Date and Timestamp as
+// time.Time, NULL as nil and all other types, including Decimal, as string.
+//
+//	rows, err := client.QueryRows(ctx, "default", "SELECT id, name FROM users")
+//	if err != nil {
+//		return err
+//	}
+//	defer rows.Close()
+//	for rows.Next() {
+//		var u struct {
+//			ID   uint64 `db:"id"`
+//			Name string `db:"name"`
+//		}
+//		if err := rows.Scan(&u); err != nil {
+//			return err
+//		}
+//	}
+//	return rows.Err()
+type Rows struct {
+	ctx      context.Context
+	pages    *Pages
+	columns  []string
+	types    []string
+	decoders []decoder
+	data     [][]string
+	values   []interface{}
+	err      error
+}
+
+// NewRows returns the rows of pages, it waits for the first page holding
+// data as the schema may only come with it. ctx is used to fetch all pages.
+func NewRows(ctx context.Context, pages *Pages) (*Rows, error) {
+	var page *dc.QueryResponse
+	for page == nil || len(page.Data) == 0 {
+		next, err := pages.Next(ctx)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			_ = pages.Close()
+			return nil, err
+		}
+		page = next
+	}
+	r := &Rows{ctx: ctx, pages: pages, data: page.Data}
+	for _, field := range page.Schema {
+		r.columns = append(r.columns, field.Name)
+		r.types = append(r.types, field.Type)
+		r.decoders = append(r.decoders, newDecoder(field.Type))
+	}
+	return r, nil
+}
+
+// QueryRows runs a query and returns its rows, they must be closed to
+// release the query on the server unless all of them are read.
+func (c *Client) QueryRows(ctx context.Context, warehouseName, sql string) (*Rows, error) {
+	r0, err := c.Query(ctx, warehouseName, sql)
+	if err != nil {
+		return nil, errors.Wrap(err, "query failed")
+	}
+	return NewRows(ctx, c.QueryPages(warehouseName, r0))
+}
+
+// ID returns the query ID.
+func (r *Rows) ID() string {
+	return r.pages.ID()
+}
+
+// Columns returns the column names.
+func (r *Rows) Columns() []string {
+	return r.columns
+}
+
+// ColumnTypes returns the Databend types of the columns, such as UInt64 or
+// Nullable(String).
+func (r *Rows) ColumnTypes() []string {
+	return r.types
+}
+
+// Next prepares the next row for Scan, it returns false after the last row
+// or an error, see Err.
+func (r *Rows) Next() bool {
+	r.values = nil
+	if r.err != nil {
+		return false
+	}
+	for len(r.data) == 0 {
+		page, err := r.pages.Next(r.ctx)
+		if err != nil {
+			r.err = err
+			return false
+		}
+		r.data = page.Data
+	}
+	row := r.data[0]
+	r.data = r.data[1:]
+	if len(row) != len(r.decoders) {
+		r.err = errors.Errorf("row has %d values, the schema has %d columns", len(row), len(r.decoders))
+		return false
+	}
+	values := make([]interface{}, len(row))
+	for i, s := range row {
+		v, err := r.decoders[i].decode(s)
+		if err != nil {
+			r.err = errors.Wrapf(err, "column %s", r.columns[i])
+			return false
+		}
+		values[i] = v
+	}
+	r.values = values
+	return true
+}
+
+// Err returns the error that ended Next, nil after the last row.
+func (r *Rows) Err() error {
+	if r.err == io.EOF {
+		return nil
+	}
+	return r.err
+}
+
+// Close releases the query on the server unless all rows were read, it
+// may be called more than once.
+func (r *Rows) Close() error {
+	if r.err == nil {
+		r.err = io.EOF
+	}
+	r.values = nil
+	return r.pages.Close()
+}
+
+// Scan copies the values of the current row into dest, either one pointer
+// per column or a single pointer to a struct. Struct fields are matched to
+// columns by their db tag or else by name ignoring case; fields tagged
+// db:"-" and columns without a field are skipped. A NULL can be scanned
+// into pointers, interfaces and sql.Null* types.
+func (r *Rows) Scan(dest ...interface{}) error {
+	if r.values == nil {
+		return errors.New("Scan called without a successful call to Next")
+	}
+	if len(dest) == 1 {
+		if v, ok := structDest(dest[0]); ok {
+			return r.scanStruct(v)
+		}
+	}
+	if len(dest) != len(r.values) {
+		return errors.Errorf("expected %d destination arguments in Scan, not %d", len(r.values), len(dest))
+	}
+	for i, d := range dest {
+		if err := assign(d, r.values[i]); err != nil {
+			return errors.Wrapf(err, "column %s", r.columns[i])
+		}
+	}
+	return nil
+}
+
+func (r *Rows) scanStruct(v reflect.Value) error {
+	fields := make(map[string][]int)
+	structFields(v.Type(), nil, fields)
+	for i, column := range r.columns {
+		index, ok := fields[strings.ToLower(column)]
+		if !ok {
+			continue
+		}
+		if err := assign(v.FieldByIndex(index).Addr().Interface(), r.values[i]); err != nil {
+			return errors.Wrapf(err, "column %s", column)
+		}
+	}
+	return nil
+}
+
+// structDest returns the struct dest points to, unless it is scanned as a
+// single value.
+func structDest(dest interface{}) (reflect.Value, bool) {
+	if _, ok := dest.(sql.Scanner); ok {
+		return reflect.Value{}, false
+	}
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct || v.Elem().Type() == reflect.TypeOf(time.Time{}) {
+		return reflect.Value{}, false
+	}
+	return v.Elem(), true
+}
+
+// structFields maps the lower case column names of the fields of t to
+// their index, fields of embedded structs are included.
+func structFields(t reflect.Type, index []int, fields map[string][]int) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("db")
+		if tag == "-" || (f.PkgPath != "" && !f.Anonymous) {
+			continue
+		}
+		fieldIndex := append(append([]int(nil), index...), i)
+		if f.Anonymous && tag == "" && f.Type.Kind() == reflect.Struct {
+			structFields(f.Type, fieldIndex, fields)
+			continue
+		}
+		name := tag
+		if name == "" {
+			name = f.Name
+		}
+		name = strings.ToLower(name)
+		if _, ok := fields[name]; !ok {
+			fields[name] = fieldIndex
+		}
+	}
+}
+
+// assign stores v into the pointer dest, converting between numbers,
+// strings and bools.
+func assign(dest interface{}, v interface{}) error {
+	switch d := dest.(type) {
+	case *interface{}:
+		*d = v
+		return nil
+	case sql.Scanner:
+		value, err := driver.DefaultParameterConverter.ConvertValue(v)
+		if err != nil {
+			return err
+		}
+		return d.Scan(value)
+	}
+	dv := reflect.ValueOf(dest)
+	if dv.Kind() != reflect.Ptr || dv.IsNil() {
+		return errors.Errorf("destination %T is not a non-nil pointer", dest)
+	}
+	el := dv.Elem()
+	if v == nil {
+		switch el.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map:
+			el.Set(reflect.Zero(el.Type()))
+			return nil
+		}
+		return errors.Errorf("cannot scan NULL into %T", dest)
+	}
+	if el.Kind() == reflect.Ptr {
+		p := reflect.New(el.Type().Elem())
+		if err := assign(p.Interface(), v); err != nil {
+			return err
+		}
+		el.Set(p)
+		return nil
+	}
+
+	sv := reflect.ValueOf(v)
+	if sv.Type().AssignableTo(el.Type()) {
+		el.Set(sv)
+		return nil
+	}
+	switch el.Kind() {
+	case reflect.String:
+		el.SetString(asString(v))
+		return nil
+	case reflect.Slice:
+		if el.Type().Elem().Kind() == reflect.Uint8 {
+			el.SetBytes([]byte(asString(v)))
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		var err error
+		switch sv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n = sv.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if sv.Uint() > 1<<63-1 {
+				return errors.Errorf("value %d overflows %T", sv.Uint(), dest)
+			}
+			n = int64(sv.Uint())
+		case reflect.String:
+			n, err = strconv.ParseInt(sv.String(), 10, 64)
+		default:
+			return errors.Errorf("cannot scan %T into %T", v, dest)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "cannot scan %q into %T", v, dest)
+		}
+		if el.OverflowInt(n) {
+			return errors.Errorf("value %d overflows %T", n, dest)
+		}
+		el.SetInt(n)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var n uint64
+		var err error
+		switch sv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if sv.Int() < 0 {
+				return errors.Errorf("value %d overflows %T", sv.Int(), dest)
+			}
+			n = uint64(sv.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			n = sv.Uint()
+		case reflect.String:
+			n, err = strconv.ParseUint(sv.String(), 10, 64)
+		default:
+			return errors.Errorf("cannot scan %T into %T", v, dest)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "cannot scan %q into %T", v, dest)
+		}
+		if el.OverflowUint(n) {
+			return errors.Errorf("value %d overflows %T", n, dest)
+		}
+		el.SetUint(n)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		var err error
+		switch sv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			f = float64(sv.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			f = float64(sv.Uint())
+		case reflect.Float32, reflect.Float64:
+			f = sv.Float()
+		case reflect.String:
+			// e.g. a Decimal
+			f, err = strconv.ParseFloat(sv.String(), 64)
+		default:
+			return errors.Errorf("cannot scan %T into %T", v, dest)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "cannot scan %q into %T", v, dest)
+		}
+		el.SetFloat(f)
+		return nil
+	case reflect.Bool:
+		if s, ok := v.(string); ok {
+			b, err := strconv.ParseBool(s)
+			if err != nil {
+				return errors.Wrapf(err, "cannot scan %q into %T", v, dest)
+			}
+			el.SetBool(b)
+			return nil
+		}
+	}
+	return errors.Errorf("cannot scan %T into %T", v, dest)
+}
+
+func asString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(v)
+}
+
+// decoder decodes the values of a column from their text.
+type decoder struct {
+	scanType reflect.Type
+	nullable bool
+	decode   func(string) (interface{}, error)
+}
+
+// newDecoder returns the decoder of a Databend type, types it does not
+// know are decoded as string.
+func newDecoder(typ string) decoder {
+	name := typ
+	nullable := strings.HasPrefix(name, "Nullable(") && strings.HasSuffix(name, ")")
+	if nullable {
+		name = strings.TrimSuffix(strings.TrimPrefix(name, "Nullable("), ")")
+	}
+	if i := strings.IndexByte(name, '('); i >= 0 {
+		name = name[:i]
+	}
+	d := decoder{nullable: nullable}
+	switch name {
+	case "UInt8", "UInt16", "UInt32", "UInt64":
+		bits, _ := strconv.Atoi(strings.TrimPrefix(name, "UInt"))
+		d.scanType, d.decode = uintDecoder(bits)
+	case "Int8", "Int16", "Int32", "Int64":
+		bits, _ := strconv.Atoi(strings.TrimPrefix(name, "Int"))
+		d.scanType, d.decode = intDecoder(bits)
+	case "Float32", "Float64":
+		bits, _ := strconv.Atoi(strings.TrimPrefix(name, "Float"))
+		d.scanType = reflect.TypeOf(float64(0))
+		if bits == 32 {
+			d.scanType = reflect.TypeOf(float32(0))
+		}
+		d.decode = func(s string) (interface{}, error) {
+			f, err := strconv.ParseFloat(s, bits)
+			if bits == 32 {
+				return float32(f), err
+			}
+			return f, err
+		}
+	case "Boolean":
+		d.scanType = reflect.TypeOf(false)
+		d.decode = func(s string) (interface{}, error) {
+			return strconv.ParseBool(s)
+		}
+	case "Date", "DateTime", "DateTime64", "Timestamp":
+		d.scanType = reflect.TypeOf(time.Time{})
+		d.decode = func(s string) (interface{}, error) {
+			layout := "2006-01-02 15:04:05.999999999"
+			if len(s) == len("2006-01-02") {
+				layout = "2006-01-02"
+			}
+			return time.Parse(layout, s)
+		}
+	default:
+		d.scanType = reflect.TypeOf("")
+		d.decode = func(s string) (interface{}, error) {
+			return s, nil
+		}
+	}
+	if nullable {
+		decode := d.decode
+		d.decode = func(s string) (interface{}, error) {
+			if s == "NULL" {
+				return nil, nil
+			}
+			return decode(s)
+		}
+	}
+	return d
+}
+
+func uintDecoder(bits int) (reflect.Type, func(string) (interface{}, error)) {
+	types := map[int]reflect.Type{8: reflect.TypeOf(uint8(0)), 16: reflect.TypeOf(uint16(0)), 32: reflect.TypeOf(uint32(0)), 64: reflect.TypeOf(uint64(0))}
+	return types[bits], func(s string) (interface{}, error) {
+		n, err := strconv.ParseUint(s, 10, bits)
+		if err != nil {
+			return nil, err
+		}
+		return reflect.ValueOf(n).Convert(types[bits]).Interface(), nil
+	}
+}
+
+func intDecoder(bits int) (reflect.Type, func(string) (interface{}, error)) {
+	types := map[int]reflect.Type{8: reflect.TypeOf(int8(0)), 16: reflect.TypeOf(int16(0)), 32: reflect.TypeOf(int32(0)), 64: reflect.TypeOf(int64(0))}
+	return types[bits], func(s string) (interface{}, error) {
+		n, err := strconv.ParseInt(s, 10, bits)
+		if err != nil {
+			return nil, err
+		}
+		return reflect.ValueOf(n).Convert(types[bits]).Interface(), nil
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	dc "github.com/databendcloud/databend-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecoder(t *testing.T) {
+	for _, tt := range []struct {
+		typ   string
+		value string
+		want  interface{}
+	}{
+		{"UInt8", "255", uint8(255)},
+		{"UInt64", "18446744073709551615", uint64(18446744073709551615)},
+		{"Int32", "-7", int32(-7)},
+		{"Float64", "1.5", 1.5},
+		{"Boolean", "true", true},
+		{"Date", "2023-01-02", time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"Timestamp", "2023-01-02 03:04:05.000006", time.Date(2023, 1, 2, 3, 4, 5, 6000, time.UTC)},
+		{"Decimal(10, 2)", "12.30", "12.30"},
+		{"String", "NULL", "NULL"},
+		{"Nullable(String)", "NULL", nil},
+		{"Nullable(Int64)", "42", int64(42)},
+		{"Array(Int32)", "[1,2]", "[1,2]"},
+	} {
+		t.Run(tt.typ, func(t *testing.T) {
+			v, err := newDecoder(tt.typ).decode(tt.value)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, v)
+		})
+	}
+	_, err := newDecoder("UInt8").decode("256")
+	assert.Error(t, err)
+}
+
+func TestRowsScan(t *testing.T) {
+	first := &dc.QueryResponse{
+		Id: "q1",
+		Schema: []dc.DataField{
+			{Name: "id", Type: "UInt64"},
+			{Name: "name", Type: "String"},
+			{Name: "score", Type: "Nullable(Float64)"},
+			{Name: "created_on", Type: "Timestamp"},
+		},
+		Data: [][]string{
+			{"1", "alice", "9.5", "2023-01-02 03:04:05"},
+			{"2", "bob", "NULL", "2023-01-03 03:04:05"},
+		},
+	}
+	rows, err := NewRows(context.Background(), NewPages(first, nil))
+	assert.NoError(t, err)
+	assert.Equal(t, "q1", rows.ID())
+	assert.Equal(t, []string{"id", "name", "score", "created_on"}, rows.Columns())
+	assert.Equal(t, "Nullable(Float64)", rows.ColumnTypes()[2])
+	assert.Error(t, rows.Scan())
+
+	assert.True(t, rows.Next())
+	var id int
+	var name []byte
+	var score *float64
+	var createdOn interface{}
+	assert.NoError(t, rows.Scan(&id, &name, &score, &createdOn))
+	assert.Equal(t, 1, id)
+	assert.Equal(t, "alice", string(name))
+	assert.Equal(t, 9.5, *score)
+	assert.Equal(t, time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC), createdOn)
+	assert.Error(t, rows.Scan(&id))
+
+	type base struct {
+		ID uint64 `db:"id"`
+	}
+	var user struct {
+		base
+		Name      string
+		Score     sql.NullFloat64 `db:"score"`
+		CreatedOn time.Time       `db:"created_on"`
+		Ignored   string          `db:"-"`
+	}
+	assert.True(t, rows.Next())
+	assert.NoError(t, rows.Scan(&user))
+	assert.Equal(t, uint64(2), user.ID)
+	assert.Equal(t, "bob", user.Name)
+	assert.False(t, user.Score.Valid)
+	assert.Equal(t, 3, user.CreatedOn.Day())
+
+	var notNull float64
+	assert.ErrorContains(t, rows.Scan(&id, &name, &notNull, &createdOn), "cannot scan NULL")
+	var small int8
+	assert.NoError(t, assign(&small, uint64(127)))
+	assert.Error(t, assign(&small, uint64(128)))
+
+	assert.False(t, rows.Next())
+	assert.NoError(t, rows.Err())
+	assert.NoError(t, rows.Close())
+}
+
+func TestRowsClose(t *testing.T) {
+	f := &fakePages{data: [][][]string{{{"1"}}, {{"2"}}}}
+	first := f.page(0)
+	first.Schema = []dc.DataField{{Name: "n", Type: "UInt8"}}
+	rows, err := NewRows(context.Background(), NewPages(first, f.fetch))
+	assert.NoError(t, err)
+	assert.True(t, rows.Next())
+	assert.NoError(t, rows.Close())
+	assert.False(t, rows.Next())
+	assert.NoError(t, rows.Err())
+	assert.Equal(t, []string{"/final"}, f.fetched)
+}
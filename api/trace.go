@@ -0,0 +1,430 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/databendcloud/bendsql/internal/build"
+)
+
+const (
+	redacted = "********"
+
+	// maxTracedBody is how much of a body is logged and recorded, larger
+	// bodies such as uploaded files are shown by their size only.
+	maxTracedBody = 64 * 1024
+)
+
+// secretHeaders are never logged.
+var secretHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+}
+
+// isSecretName reports whether a JSON key, form field or query parameter
+// holds a secret, e.g. password, accessToken, refresh_token, code_verifier
+// or X-Amz-Signature of presigned URLs.
+func isSecretName(name string) bool {
+	name = strings.ToLower(name)
+	for _, s := range []string{"password", "token", "secret", "signature", "credential", "code_verifier", "device_code"} {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func redactURL(u *url.URL) string {
+	query := u.Query()
+	if len(query) == 0 {
+		return u.String()
+	}
+	for k := range query {
+		if isSecretName(k) {
+			query.Set(k, redacted)
+		}
+	}
+	c := *u
+	c.RawQuery = query.Encode()
+	return strings.ReplaceAll(c.String(), url.QueryEscape(redacted), redacted)
+}
+
+func redactHeaders(h http.Header) http.Header {
+	c := h.Clone()
+	for k := range c {
+		if secretHeaders[http.CanonicalHeaderKey(k)] {
+			c.Set(k, redacted)
+		}
+	}
+	return c
+}
+
+// redactBody masks secrets of JSON and form bodies, other bodies are
+// replaced by their size.
+func redactBody(mimeType string, body []byte, size int64) string {
+	if size > maxTracedBody || int64(len(body)) < size {
+		return fmt.Sprintf("<%d bytes>", size)
+	}
+	switch {
+	case len(body) == 0:
+		return ""
+	case strings.Contains(mimeType, "json"):
+		var v interface{}
+		if err := json.Unmarshal(body, &v); err != nil {
+			return fmt.Sprintf("<%d bytes of invalid json>", len(body))
+		}
+		redacted, _ := json.Marshal(redactJSON(v))
+		return string(redacted)
+	case strings.Contains(mimeType, "x-www-form-urlencoded"):
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return fmt.Sprintf("<%d bytes of invalid form>", len(body))
+		}
+		for k := range form {
+			// code is the authorization code of the web login
+			if isSecretName(k) || k == "code" {
+				form.Set(k, redacted)
+			}
+		}
+		return strings.ReplaceAll(form.Encode(), url.QueryEscape(redacted), redacted)
+	case strings.HasPrefix(mimeType, "text/"):
+		return string(body)
+	default:
+		return fmt.Sprintf("<%d bytes>", len(body))
+	}
+}
+
+func redactJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, value := range v {
+			if _, ok := value.(string); ok && isSecretName(k) {
+				v[k] = redacted
+			} else {
+				v[k] = redactJSON(value)
+			}
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = redactJSON(v[i])
+		}
+	}
+	return v
+}
+
+// peekBody returns up to maxTracedBody bytes of body and a body that still
+// reads the whole content.
+func peekBody(body io.ReadCloser) ([]byte, io.ReadCloser, error) {
+	if body == nil || body == http.NoBody {
+		return nil, body, nil
+	}
+	prefix, err := io.ReadAll(io.LimitReader(body, maxTracedBody+1))
+	if err != nil {
+		return nil, body, err
+	}
+	return prefix, struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(prefix), body), body}, nil
+}
+
+// gunzipBody decompresses a gzip body for display, it returns up to
+// maxTracedBody+1 bytes and the decompressed size.
+func gunzipBody(body []byte) ([]byte, int64) {
+	zr, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return body, int64(len(body))
+	}
+	content, err := io.ReadAll(io.LimitReader(zr, maxTracedBody+1))
+	if err != nil {
+		return body, int64(len(body))
+	}
+	rest, _ := io.Copy(io.Discard, zr)
+	return content, int64(len(content)) + rest
+}
+
+// tracingTransport logs requests with their secrets redacted and records
+// them to a HAR file.
+type tracingTransport struct {
+	base http.RoundTripper
+	out  io.Writer
+	har  *HARRecorder
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	entry := harEntry{
+		StartedDateTime: time.Now(),
+		Request: harRequest{
+			Method:      req.Method,
+			URL:         redactURL(req.URL),
+			HTTPVersion: req.Proto,
+			Headers:     harHeaders(redactHeaders(req.Header)),
+			QueryString: []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    req.ContentLength,
+		},
+		Cache: struct{}{},
+	}
+	var err error
+	var reqBody []byte
+	if req.ContentLength <= maxTracedBody {
+		reqBody, req.Body, err = peekBody(req.Body)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read http request body")
+		}
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		size := req.ContentLength
+		if size < 0 {
+			size = int64(len(reqBody))
+		}
+		entry.Request.PostData = &harPostData{
+			MimeType: req.Header.Get(contentType),
+			Text:     redactBody(req.Header.Get(contentType), reqBody, size),
+		}
+	}
+	if t.out != nil {
+		fmt.Fprintf(t.out, "> %s %s\n", req.Method, entry.Request.URL)
+		for _, h := range entry.Request.Headers {
+			fmt.Fprintf(t.out, "> %s: %s\n", h.Name, h.Value)
+		}
+		if entry.Request.PostData != nil {
+			fmt.Fprintf(t.out, "> %s\n", entry.Request.PostData.Text)
+		}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	elapsed := time.Since(entry.StartedDateTime)
+	entry.Time = float64(elapsed.Microseconds()) / 1000
+	entry.Timings = harTimings{Send: 0, Wait: entry.Time, Receive: 0}
+	if err != nil {
+		entry.Comment = err.Error()
+		entry.Response = harResponse{Headers: []harNameValue{}, HeadersSize: -1, BodySize: -1}
+		if t.out != nil {
+			fmt.Fprintf(t.out, "< error after %s: %v\n\n", elapsed.Round(time.Millisecond), err)
+		}
+		t.har.add(entry)
+		return nil, err
+	}
+
+	var respBody []byte
+	respBody, resp.Body, err = peekBody(resp.Body)
+	if err != nil {
+		resp.Body.Close()
+		return nil, errors.Wrap(err, "failed to read http response body")
+	}
+	size := resp.ContentLength
+	if size < 0 {
+		size = int64(len(respBody))
+	}
+	mimeType := resp.Header.Get(contentType)
+	content, contentSize := respBody, size
+	if resp.Header.Get(contentEncoding) == "gzip" && int64(len(respBody)) == size {
+		content, contentSize = gunzipBody(respBody)
+	}
+	entry.Response = harResponse{
+		Status:      resp.StatusCode,
+		StatusText:  http.StatusText(resp.StatusCode),
+		HTTPVersion: resp.Proto,
+		Headers:     harHeaders(redactHeaders(resp.Header)),
+		Content: harContent{
+			Size:        contentSize,
+			Compression: contentSize - size,
+			MimeType:    mimeType,
+			Text:        redactBody(mimeType, content, contentSize),
+		},
+		HeadersSize: -1,
+		BodySize:    size,
+	}
+	if t.out != nil {
+		fmt.Fprintf(t.out, "< %s (%s)\n", resp.Status, elapsed.Round(time.Millisecond))
+		for _, h := range entry.Response.Headers {
+			fmt.Fprintf(t.out, "< %s: %s\n", h.Name, h.Value)
+		}
+		fmt.Fprintf(t.out, "< %s\n\n", entry.Response.Content.Text)
+	}
+	t.har.add(entry)
+	return resp, nil
+}
+
+// HARRecorder saves the traced requests of a session to a HAR 1.2 file.
+// Entries are appended as requests complete, each time followed by the end
+// of the file, so that it is complete even if bendsql fails and long
+// sessions neither hold their entries in memory nor rewrite them.
+type HARRecorder struct {
+	path string
+
+	mu   sync.Mutex
+	file *os.File
+	// end is the offset of the end of the file, which the next entry
+	// overwrites
+	end int64
+	err error
+}
+
+const harEnd = "\n  ]}\n}\n"
+
+func NewHARRecorder(path string) *HARRecorder {
+	return &HARRecorder{path: path}
+}
+
+// Err returns the first error writing the file.
+func (r *HARRecorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// Close closes the file and returns the first error writing it.
+func (r *HARRecorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file != nil {
+		if err := r.file.Close(); err != nil && r.err == nil {
+			r.err = errors.Wrapf(err, "failed to write har file %s", r.path)
+		}
+		r.file = nil
+	}
+	return r.err
+}
+
+func (r *HARRecorder) add(entry harEntry) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+	if err := r.write(entry); err != nil {
+		r.err = errors.Wrapf(err, "failed to write har file %s", r.path)
+	}
+}
+
+func (r *HARRecorder) write(entry harEntry) error {
+	var buf bytes.Buffer
+	if r.file == nil {
+		f, err := os.OpenFile(r.path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+		r.file = f
+		creator, err := json.Marshal(map[string]string{"name": "bendsql", "version": build.Version})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&buf, "{\n  \"log\": {\"version\": \"1.2\", \"creator\": %s, \"entries\": [\n", creator)
+	} else {
+		buf.WriteString(",\n")
+	}
+	content, err := json.MarshalIndent(entry, "    ", "  ")
+	if err != nil {
+		return err
+	}
+	buf.WriteString("    ")
+	buf.Write(content)
+	if _, err := r.file.WriteAt(append(buf.Bytes(), harEnd...), r.end); err != nil {
+		return err
+	}
+	r.end += int64(buf.Len())
+	return nil
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harContent struct {
+	Size        int64  `json:"size"`
+	Compression int64  `json:"compression,omitempty"`
+	MimeType    string `json:"mimeType"`
+	Text        string `json:"text,omitempty"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+type harEntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+func harHeaders(h http.Header) []harNameValue {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	headers := []harNameValue{}
+	for _, k := range keys {
+		for _, v := range h[k] {
+			headers = append(headers, harNameValue{Name: k, Value: v})
+		}
+	}
+	return headers
+}
@@ -0,0 +1,140 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTraceRedactsSecrets(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/v1/account/sign-in":
+			_, _ = w.Write([]byte(`{"data":{"accessToken":"secret-access","refreshToken":"secret-refresh","expiresAt":"2099-01-01T00:00:00Z"}}`))
+		default:
+			_, _ = w.Write([]byte(`{"data":[{"orgSlug":"databend"}]}`))
+		}
+	}))
+	defer srv.Close()
+
+	var trace bytes.Buffer
+	harPath := filepath.Join(t.TempDir(), "session.har")
+	har := NewHARRecorder(harPath)
+	assert.NoError(t, SetTransportOptions(TransportOptions{Timeout: DefaultTimeout, Trace: &trace, HAR: har}))
+	defer func() { _ = SetTransportOptions(TransportOptions{Timeout: DefaultTimeout}) }()
+	c := newTestClient(t, srv.URL)
+	assert.NoError(t, c.Login(context.Background(), "alice@example.com", "secret-password"))
+	orgs, err := c.ListOrgs(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, orgs, 1)
+	assert.NoError(t, har.Err())
+
+	log := trace.String()
+	assert.Contains(t, log, "> POST "+srv.URL+"/api/v1/account/sign-in")
+	assert.Contains(t, log, `"email":"alice@example.com"`)
+	assert.Contains(t, log, "< 200 OK")
+	assert.Contains(t, log, "databend")
+	content, err := os.ReadFile(harPath)
+	assert.NoError(t, err)
+	for _, s := range [][]byte{trace.Bytes(), content} {
+		assert.NotContains(t, string(s), "secret-")
+		assert.Contains(t, string(s), redacted)
+	}
+
+	var session struct {
+		Log struct {
+			Version string `json:"version"`
+			Entries []struct {
+				Request struct {
+					Method string `json:"method"`
+				} `json:"request"`
+				Response struct {
+					Status int `json:"status"`
+				} `json:"response"`
+			} `json:"entries"`
+		} `json:"log"`
+	}
+	assert.NoError(t, json.Unmarshal(content, &session))
+	assert.Equal(t, "1.2", session.Log.Version)
+	assert.Len(t, session.Log.Entries, 2)
+	assert.Equal(t, "POST", session.Log.Entries[0].Request.Method)
+	assert.Equal(t, 200, session.Log.Entries[1].Response.Status)
+}
+
+func TestHARRecorderAppends(t *testing.T) {
+	harPath := filepath.Join(t.TempDir(), "session.har")
+	har := NewHARRecorder(harPath)
+	var session struct {
+		Log struct {
+			Creator struct {
+				Name string `json:"name"`
+			} `json:"creator"`
+			Entries []harEntry `json:"entries"`
+		} `json:"log"`
+	}
+	for i := 1; i <= 3; i++ {
+		har.add(harEntry{Request: harRequest{Method: "GET", URL: fmt.Sprintf("https://example.com/%d", i)}})
+		// the file is complete after every entry
+		content, err := os.ReadFile(harPath)
+		assert.NoError(t, err)
+		assert.NoError(t, json.Unmarshal(content, &session))
+		assert.Equal(t, "bendsql", session.Log.Creator.Name)
+		assert.Len(t, session.Log.Entries, i)
+	}
+	assert.Equal(t, "https://example.com/3", session.Log.Entries[2].Request.URL)
+	assert.NoError(t, har.Close())
+	assert.NoError(t, har.Close())
+}
+
+func TestRedact(t *testing.T) {
+	u, _ := http.NewRequest("PUT", "https://s3.example.com/stage/a.csv?X-Amz-Signature=abc&X-Amz-Credential=def&partNumber=1", nil)
+	assert.Equal(t, "https://s3.example.com/stage/a.csv?X-Amz-Credential=********&X-Amz-Signature=********&partNumber=1", redactURL(u.URL))
+
+	assert.Equal(t, "client_id=bendsql&code=********&code_verifier=********",
+		redactBody("application/x-www-form-urlencoded", []byte("client_id=bendsql&code=abc&code_verifier=def"), 44))
+	assert.Equal(t, `{"data":{"items":[{"token":"********"}],"name":"w1"}}`,
+		redactBody("application/json", []byte(`{"data":{"name":"w1","items":[{"token":"t"}]}}`), 46))
+	assert.Equal(t, "<100000 bytes>", redactBody("text/csv", nil, 100000))
+
+	h := http.Header{"Authorization": {"Bearer t"}, "Accept": {"application/json"}}
+	assert.Equal(t, http.Header{"Authorization": {redacted}, "Accept": {"application/json"}}, redactHeaders(h))
+}
+
+func TestGunzipBody(t *testing.T) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, _ = zw.Write([]byte(strings.Repeat("a", maxTracedBody+10)))
+	_ = zw.Close()
+	content, size := gunzipBody(buf.Bytes())
+	assert.Equal(t, int64(maxTracedBody+10), size)
+	assert.Len(t, content, maxTracedBody+1)
+
+	content, size = gunzipBody([]byte("plain"))
+	assert.Equal(t, "plain", string(content))
+	assert.Equal(t, int64(5), size)
+}
@@ -0,0 +1,108 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// TransportOptions configure the HTTP transport of a Client. NewClient uses
+// those set from the global --http-timeout, --proxy, --debug-http and --har
+// flags, New those of WithTransportOptions.
+type TransportOptions struct {
+	// Timeout limits each request including reading the response body,
+	// uploads only wait at most Timeout for the response to start. Zero
+	// means no timeout.
+	Timeout time.Duration
+	// Proxy is an http, https, socks5 or socks5h URL. HTTP_PROXY, HTTPS_PROXY
+	// and NO_PROXY are used if it is empty.
+	Proxy string
+	// Trace logs every request and response with secrets redacted.
+	Trace io.Writer
+	// HAR records every request and response with secrets redacted.
+	HAR *HARRecorder
+}
+
+const (
+	DefaultTimeout = 60 * time.Second
+
+	connectTimeout = 10 * time.Second
+)
+
+var transportOptions = TransportOptions{Timeout: DefaultTimeout}
+
+// SetTransportOptions sets the options of clients created afterwards.
+func SetTransportOptions(opts TransportOptions) error {
+	if opts.Proxy != "" {
+		if _, err := parseProxy(opts.Proxy); err != nil {
+			return err
+		}
+	}
+	transportOptions = opts
+	return nil
+}
+
+func parseProxy(proxy string) (*url.URL, error) {
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid proxy %s", proxy)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, errors.Errorf("invalid proxy %s, expected an http, https, socks5 or socks5h URL", proxy)
+	}
+	if u.Host == "" {
+		return nil, errors.Errorf("invalid proxy %s, the host is missing", proxy)
+	}
+	return u, nil
+}
+
+// newTransport returns a transport reusing connections across the requests
+// of a client, which fails requests to unresponsive servers instead of
+// hanging.
+func newTransport(opts TransportOptions) (http.RoundTripper, error) {
+	proxy := http.ProxyFromEnvironment
+	if opts.Proxy != "" {
+		u, err := parseProxy(opts.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		proxy = http.ProxyURL(u)
+	}
+	var transport http.RoundTripper = &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   connectTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   connectTimeout,
+		ResponseHeaderTimeout: opts.Timeout,
+		ExpectContinueTimeout: time.Second,
+	}
+	if opts.Trace != nil || opts.HAR != nil {
+		transport = &tracingTransport{base: transport, out: opts.Trace, har: opts.HAR}
+	}
+	return transport, nil
+}
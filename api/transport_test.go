@@ -0,0 +1,72 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransportTimeoutAndCancel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(5 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+
+	assert.NoError(t, SetTransportOptions(TransportOptions{Timeout: 100 * time.Millisecond}))
+	defer func() { _ = SetTransportOptions(TransportOptions{Timeout: DefaultTimeout}) }()
+	SetRetryPolicy(RetryPolicy{Attempts: 1})
+	defer SetRetryPolicy(RetryPolicy{})
+	c := newTestClient(t, srv.URL)
+	c.LoginWithToken("api-key")
+	start := time.Now()
+	_, err := c.ListOrgs(context.Background())
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+
+	assert.NoError(t, SetTransportOptions(TransportOptions{}))
+	c = newTestClient(t, srv.URL)
+	c.LoginWithToken("api-key")
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	_, err = c.ListOrgs(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestTransportProxy(t *testing.T) {
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+		_, _ = w.Write([]byte(`{"data":[]}`))
+	}))
+	defer proxy.Close()
+
+	assert.Error(t, SetTransportOptions(TransportOptions{Proxy: "ftp://proxy.internal"}))
+	assert.NoError(t, SetTransportOptions(TransportOptions{Timeout: DefaultTimeout, Proxy: proxy.URL}))
+	defer func() { _ = SetTransportOptions(TransportOptions{Timeout: DefaultTimeout}) }()
+	c := newTestClient(t, "http://databend.internal")
+	c.LoginWithToken("api-key")
+	_, err := c.ListOrgs(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"http://databend.internal/api/v1/my/orgs"}, proxied)
+}
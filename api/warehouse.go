@@ -15,48 +15,49 @@
 package api
 
 import (
+	"context"
 	"fmt"
 	"time"
 
 	"github.com/avast/retry-go"
 )
 
-func (c *Client) ListWarehouses() ([]WarehouseStatusDTO, error) {
+func (c *Client) ListWarehouses(ctx context.Context) ([]WarehouseStatusDTO, error) {
 	path := fmt.Sprintf("/api/v1/orgs/%s/tenant/warehouses", c.cfg.Org)
 	data := struct {
 		Data []WarehouseStatusDTO `json:"data"`
 	}{}
-	err := c.DoRequest("GET", path, nil, nil, &data)
+	err := c.DoRequest(ctx, "GET", path, nil, nil, &data)
 	if err != nil {
 		return []WarehouseStatusDTO{}, fmt.Errorf("failed to view warehouse: %w", err)
 	}
 	return data.Data, err
 }
 
-func (c *Client) ViewWarehouse(warehouseName string) (*WarehouseStatusDTO, error) {
+func (c *Client) ViewWarehouse(ctx context.Context, warehouseName string) (*WarehouseStatusDTO, error) {
 	path := fmt.Sprintf("/api/v1/orgs/%s/tenant/warehouses/%s", c.cfg.Org, warehouseName)
 	data := struct {
 		Data WarehouseStatusDTO `json:"data"`
 	}{}
-	err := c.DoRequest("GET", path, nil, nil, &data)
+	err := c.DoRequest(ctx, "GET", path, nil, nil, &data)
 	if err != nil {
 		return nil, fmt.Errorf("failed to view warehouse: %w", err)
 	}
 	return &data.Data, err
 }
 
-func (c *Client) ResumeWarehouse(warehouseName string) error {
+func (c *Client) ResumeWarehouse(ctx context.Context, warehouseName string) error {
 	path := fmt.Sprintf("/api/v1/orgs/%s/tenant/warehouses/%s/resume", c.cfg.Org, warehouseName)
-	err := c.DoRequest("POST", path, nil, nil, nil)
+	err := c.DoRequest(ctx, "POST", path, nil, nil, nil)
 	if err != nil {
 		return fmt.Errorf("failed to resume warehouse: %w", err)
 	}
 	return nil
 }
 
-func (c *Client) SuspendWarehouse(warehouseName string) error {
+func (c *Client) SuspendWarehouse(ctx context.Context, warehouseName string) error {
 	path := fmt.Sprintf("/api/v1/orgs/%s/tenant/warehouses/%s/suspend", c.cfg.Org, warehouseName)
-	err := c.DoRequest("POST", path, nil, nil, nil)
+	err := c.DoRequest(ctx, "POST", path, nil, nil, nil)
 	if err != nil {
 		return fmt.Errorf("failed to suspend warehouse: %w", err)
 	}
@@ -70,51 +71,63 @@ type CreateWarehouseRequestBody struct {
 	Size      string `json:"size,omitempty"`
 }
 
-func (c *Client) CreateWarehouse(warehouseName, size, tag string) error {
+func (c *Client) CreateWarehouse(ctx context.Context, warehouseName, size, tag string) error {
 	req := &CreateWarehouseRequestBody{
 		Name:     warehouseName,
 		Size:     size,
 		ImageTag: tag,
 	}
 	path := fmt.Sprintf("/api/v1/orgs/%s/tenant/warehouses", c.cfg.Org)
-	err := c.DoRequest("POST", path, nil, req, nil)
+	err := c.DoRequest(ctx, "POST", path, nil, req, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create warehouse: %w", err)
 	}
 	return nil
 }
 
-func (c *Client) DeleteWarehouse(warehouseName string) error {
+func (c *Client) DeleteWarehouse(ctx context.Context, warehouseName string) error {
 	path := fmt.Sprintf("/api/v1/orgs/%s/tenant/warehouses/%s", c.cfg.Org, warehouseName)
-	err := c.DoRequest("DELETE", path, nil, nil, nil)
+	err := c.DoRequest(ctx, "DELETE", path, nil, nil, nil)
 	if err != nil {
 		return fmt.Errorf("failed to delete warehouse: %w", err)
 	}
 	return nil
 }
 
-func (c *Client) CreateWarehouseAndWaitRunning(warehouseName, size, tag string) error {
-	err := c.CreateWarehouse(warehouseName, size, tag)
+func (c *Client) CreateWarehouseAndWaitRunning(ctx context.Context, warehouseName, size, tag string) error {
+	err := c.CreateWarehouse(ctx, warehouseName, size, tag)
 	if err != nil {
 		return err
 	}
-	err = retry.Do(
-		func() (err error) {
-			err = c.ResumeWarehouse(warehouseName)
-			if err != nil {
-				panic(err)
-			}
-			status, err := c.ViewWarehouse(warehouseName)
+	err = c.ResumeWarehouse(ctx, warehouseName)
+	if err != nil {
+		return err
+	}
+	return c.WaitWarehouseRunning(ctx, warehouseName, 10*time.Second)
+}
+
+// WaitWarehouseRunning polls the warehouse every second until it is Running
+// or timeout passes, failed requests are retried by the client's policy.
+func (c *Client) WaitWarehouseRunning(ctx context.Context, warehouseName string, timeout time.Duration) error {
+	attempts := uint(timeout / time.Second)
+	if attempts == 0 {
+		attempts = 1
+	}
+	return retry.Do(
+		func() error {
+			status, err := c.ViewWarehouse(ctx, warehouseName)
 			if err != nil {
-				panic(err)
+				return retry.Unrecoverable(err)
 			}
 			if status.State != "Running" {
-				return fmt.Errorf("state is %s", status.State)
+				return fmt.Errorf("warehouse %s is not running after %s, state is %s", warehouseName, timeout, status.State)
 			}
 			return nil
 		},
+		retry.Context(ctx),
 		retry.Delay(1*time.Second),
-		retry.Attempts(10),
+		retry.DelayType(retry.FixedDelay),
+		retry.Attempts(attempts),
+		retry.LastErrorOnly(true),
 	)
-	return err
 }
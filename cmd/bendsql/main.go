@@ -15,11 +15,14 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net"
 	"os"
+	"os/signal"
 	"strings"
 
 	"github.com/databendcloud/bendsql/utils"
@@ -28,6 +31,7 @@ import (
 
 	surveyCore "github.com/AlecAivazis/survey/v2/core"
 	"github.com/AlecAivazis/survey/v2/terminal"
+	"github.com/databendcloud/bendsql/api"
 	"github.com/databendcloud/bendsql/internal/build"
 	"github.com/databendcloud/bendsql/pkg/cmd/root"
 	"github.com/databendcloud/bendsql/pkg/cmdutil"
@@ -35,21 +39,12 @@ import (
 	"github.com/mgutz/ansi"
 )
 
-type exitCode int
-
-const (
-	exitOK     exitCode = 0
-	exitError  exitCode = 1
-	exitCancel exitCode = 2
-	exitAuth   exitCode = 4
-)
-
 func main() {
 	code := mainRun()
 	os.Exit(int(code))
 }
 
-func mainRun() exitCode {
+func mainRun() cmdutil.ExitCode {
 	buildDate := build.Date
 	buildVersion := build.Version
 
@@ -74,37 +69,47 @@ func mainRun() exitCode {
 		}
 	}
 
-	authError := errors.New("authError")
+	// the first Ctrl-C cancels the requests in flight, a second one terminates
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
 
 	rootCmd := root.NewCmdRoot(cmdFactory, buildVersion, buildDate)
-	if cmd, err := rootCmd.ExecuteC(); err != nil {
+	if cmd, err := rootCmd.ExecuteContextC(ctx); err != nil {
 		var pagerPipeError *iostreams.ErrClosedPagerPipe
 		var noResultsError cmdutil.NoResultsError
 		if err == cmdutil.SilentError {
-			return exitError
-		} else if cmdutil.IsUserCancellation(err) {
-			if errors.Is(err, terminal.InterruptErr) {
-				// ensure the next shell prompt will start on its own line
-				fmt.Fprint(stderr, "\n")
-			}
-			return exitCancel
-		} else if errors.Is(err, authError) {
-			return exitAuth
+			return cmdutil.ExitError
 		} else if errors.As(err, &pagerPipeError) {
 			// ignore the error raised when piping to a closed pager
-			return exitOK
+			return cmdutil.ExitOK
 		} else if errors.As(err, &noResultsError) {
 			if cmdFactory.IOStreams.IsStdoutTTY() {
 				fmt.Fprintln(stderr, noResultsError.Error())
 			}
 			// no results is not a command failure
-			return exitOK
+			return cmdutil.ExitOK
 		}
-		printError(stderr, err, cmd, hasDebug)
 
-		return exitError
+		if format, _ := rootCmd.PersistentFlags().GetString("error-format"); format == "json" {
+			printErrorJSON(stderr, err)
+		} else if cmdutil.IsUserCancellation(err) {
+			var cancelled *api.QueryCancelledError
+			if errors.As(err, &cancelled) {
+				fmt.Fprintf(stderr, "\n%s\n", cancelled)
+			} else if errors.Is(err, terminal.InterruptErr) || errors.Is(err, context.Canceled) {
+				// ensure the next shell prompt will start on its own line
+				fmt.Fprint(stderr, "\n")
+			}
+		} else {
+			printError(stderr, err, cmd, hasDebug)
+		}
+		return cmdutil.ExitCodeOf(err)
 	}
-	return exitOK
+	return cmdutil.ExitOK
 }
 
 func printError(out io.Writer, err error, cmd *cobra.Command, debug bool) {
@@ -118,6 +123,9 @@ func printError(out io.Writer, err error, cmd *cobra.Command, debug bool) {
 		return
 	}
 	fmt.Fprintln(out, err)
+	if e := api.AsError(err); e != nil && e.Hint != "" && !strings.Contains(err.Error(), e.Hint) {
+		fmt.Fprintln(out, e.Hint)
+	}
 
 	var flagError *cmdutil.FlagError
 	if errors.As(err, &flagError) || strings.HasPrefix(err.Error(), "unknown command ") {
@@ -127,3 +135,11 @@ func printError(out io.Writer, err error, cmd *cobra.Command, debug bool) {
 		fmt.Fprintln(out, cmd.UsageString())
 	}
 }
+
+// printErrorJSON prints err as a single line of JSON for scripts.
+func printErrorJSON(out io.Writer, err error) {
+	content, _ := json.Marshal(struct {
+		Error cmdutil.ErrorJSON `json:"error"`
+	}{cmdutil.NewErrorJSON(err)})
+	fmt.Fprintln(out, string(content))
+}
@@ -16,9 +16,11 @@ package main
 
 import (
 	"bytes"
+	"fmt"
 	"net"
 	"testing"
 
+	dc "github.com/databendcloud/databend-go"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
@@ -39,7 +41,7 @@ func Test_printError(t *testing.T) {
 		{
 			name: "DNS error",
 			args: args{
-				err: errors.Errorf("DNS oopsie: %w", &net.DNSError{
+				err: fmt.Errorf("DNS oopsie: %w", &net.DNSError{
 					Name: "api.datafusecloud.com",
 				}),
 				cmd:   nil,
@@ -68,3 +70,12 @@ func Test_printError(t *testing.T) {
 		})
 	}
 }
+
+func Test_printErrorJSON(t *testing.T) {
+	out := &bytes.Buffer{}
+	printErrorJSON(out, fmt.Errorf("view warehouse: %w", dc.NewAPIError("", 404, []byte(`{"message":"warehouse w1 not found"}`))))
+	want := `{"error":{"kind":"not_found","message":"view warehouse: 404 warehouse w1 not found","hint":"please check the name, e.g. with ` + "`bendsql cloud warehouse ls`" + `.","exit_code":5,"status":404}}` + "\n"
+	if gotOut := out.String(); gotOut != want {
+		t.Errorf("printErrorJSON() = %q, want %q", gotOut, want)
+	}
+}
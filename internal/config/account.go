@@ -0,0 +1,112 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// AccountKey identifies a cloud login by its endpoint and account, e.g.
+// app.databend.com/alice@example.com.
+func AccountKey(endpoint, account string) string {
+	host := strings.TrimSuffix(endpoint, "/")
+	if i := strings.Index(host, "://"); i >= 0 {
+		host = host[i+3:]
+	}
+	if account == "" {
+		return host
+	}
+	return host + "/" + account
+}
+
+// Key returns the AccountKey of the account c is logged in to.
+func (c *CloudConfig) Key() string {
+	return AccountKey(c.Endpoint, c.Account)
+}
+
+// AddAccount makes login the active account of c. The account active before
+// is kept in Accounts if it is a different login, so that it can be switched
+// back to without logging in again.
+func (c *CloudConfig) AddAccount(login *CloudConfig) {
+	accounts := c.Accounts
+	if c.Token != nil && c.Key() != login.Key() {
+		if accounts == nil {
+			accounts = make(map[string]*CloudConfig)
+		}
+		previous := *c
+		previous.Accounts = nil
+		accounts[c.Key()] = &previous
+	}
+	delete(accounts, login.Key())
+	*c = *login
+	c.Accounts = accounts
+	if len(c.Accounts) == 0 {
+		c.Accounts = nil
+	}
+}
+
+// SwitchAccount makes the account with the given key active, the active one
+// is kept in Accounts. An email is accepted instead of the key as long as it
+// is logged in to on a single endpoint.
+func (c *CloudConfig) SwitchAccount(key string) error {
+	if key == c.Key() {
+		return nil
+	}
+	login, ok := c.Accounts[key]
+	if !ok {
+		var matches []string
+		for _, k := range c.AccountKeys() {
+			if c.FindAccount(k).Account == key {
+				matches = append(matches, k)
+			}
+		}
+		switch len(matches) {
+		case 0:
+			return errors.Errorf("account %s not found, please use `bendsql cloud account ls` to list accounts", key)
+		case 1:
+			return c.SwitchAccount(matches[0])
+		default:
+			return errors.Errorf("account %s is logged in to on %s, please specify one of them", key, strings.Join(matches, ", "))
+		}
+	}
+	c.AddAccount(login)
+	return nil
+}
+
+// FindAccount returns the active account or one of Accounts by key, or nil
+// if it is not logged in.
+func (c *CloudConfig) FindAccount(key string) *CloudConfig {
+	if c.Key() == key {
+		return c
+	}
+	return c.Accounts[key]
+}
+
+// AccountKeys returns the keys of all accounts of c, the active one first
+// and the others in alphabetical order.
+func (c *CloudConfig) AccountKeys() []string {
+	var keys []string
+	for key := range c.Accounts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if c.Token != nil {
+		keys = append([]string{c.Key()}, keys...)
+	}
+	return keys
+}
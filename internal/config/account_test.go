@@ -0,0 +1,61 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccountKey(t *testing.T) {
+	assert.Equal(t, "app.databend.com/alice@example.com", AccountKey("https://app.databend.com/", "alice@example.com"))
+	assert.Equal(t, "localhost:8080", AccountKey("http://localhost:8080", ""))
+}
+
+func TestSwitchAccount(t *testing.T) {
+	c := &CloudConfig{}
+	c.AddAccount(&CloudConfig{Endpoint: "https://app.databend.com", Account: "alice@example.com", Org: "a", Token: &Token{AccessToken: "1"}})
+	c.AddAccount(&CloudConfig{Endpoint: "https://app.databend.cn", Account: "alice@example.com", Org: "b", Token: &Token{AccessToken: "2"}})
+	c.AddAccount(&CloudConfig{Endpoint: "https://app.databend.cn", Account: "bob@example.com", Org: "c", Token: &Token{AccessToken: "3"}})
+	assert.Equal(t, []string{
+		"app.databend.cn/bob@example.com",
+		"app.databend.cn/alice@example.com",
+		"app.databend.com/alice@example.com",
+	}, c.AccountKeys())
+
+	// logging in again replaces the account
+	c.AddAccount(&CloudConfig{Endpoint: "https://app.databend.cn", Account: "bob@example.com", Org: "d", Token: &Token{AccessToken: "4"}})
+	assert.Len(t, c.Accounts, 2)
+	assert.Equal(t, "d", c.Org)
+
+	assert.NoError(t, c.SwitchAccount("app.databend.com/alice@example.com"))
+	assert.Equal(t, "a", c.Org)
+	assert.Equal(t, "1", c.Token.AccessToken)
+	assert.Equal(t, "4", c.Accounts["app.databend.cn/bob@example.com"].Token.AccessToken)
+
+	assert.NoError(t, c.SwitchAccount("bob@example.com"))
+	assert.Equal(t, "d", c.Org)
+	assert.EqualError(t, c.SwitchAccount("alice@example.com"), "account alice@example.com is logged in to on app.databend.cn/alice@example.com, app.databend.com/alice@example.com, please specify one of them")
+	assert.EqualError(t, c.SwitchAccount("carol@example.com"), "account carol@example.com not found, please use `bendsql cloud account ls` to list accounts")
+
+	// accounts survive a round trip through config.toml
+	cfg := &Config{Profiles: map[string]*Profile{DefaultProfile: {Target: TARGET_CLOUD, Cloud: c}}}
+	content, err := encodeConfig(cfg)
+	assert.NoError(t, err)
+	decoded, _, _, err := decodeConfig(content)
+	assert.NoError(t, err)
+	assert.Equal(t, c.AccountKeys(), decoded.Profiles[DefaultProfile].Cloud.AccountKeys())
+}
@@ -15,70 +15,213 @@
 package config
 
 import (
+	"bytes"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/BurntSushi/toml"
 	dc "github.com/databendcloud/databend-go"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 )
 
+var errNoConfigPath = errors.New("can not find home directory, please use --config to set the config file")
+
 const (
 	TARGET_COMMUNITY = "community"
 	TARGET_CLOUD     = "cloud"
+
+	DefaultProfile = "default"
 )
 
 var (
+	// configFile is set from the global --config flag, BENDSQL_CONFIG and
+	// ~/.config/bendsql/config.toml are used otherwise.
 	configFile = ""
+
+	// ephemeral keeps every change in memory, nothing is written to disk.
+	ephemeral = false
+
+	// profileOverride is set from the global --profile flag and takes
+	// precedence over BENDSQL_PROFILE and the current_profile key.
+	profileOverride = ""
 )
 
-func init() {
-	if a := os.Getenv("BENDSQL_CONFIG"); a != "" {
-		configFile = a
-	} else {
-		d, err := os.UserHomeDir()
-		if err != nil {
-			panic(err)
-		}
-		configFile = filepath.Join(d, ".config", "bendsql", "config.toml")
-	}
-	if !exists(configFile) {
-		fmt.Printf("config file %s not found, creating a new one\n", configFile)
-		if !exists(filepath.Dir(configFile)) {
-			err := os.MkdirAll(filepath.Dir(configFile), 0755)
-			if err != nil {
-				panic(err)
-			}
-		}
-		f, err := os.Create(configFile)
-		if err != nil {
-			panic(err)
-		}
-		defer f.Close()
-	}
+type Config struct {
+	// Version is the layout of the file, older files are upgraded on load.
+	Version         int                 `toml:"version,omitempty"`
+	CurrentProfile  string              `toml:"current_profile,omitempty"`
+	CredentialStore string              `toml:"credential_store,omitempty"`
+	Profiles        map[string]*Profile `toml:"profiles,omitempty"`
+	// Endpoints are private Databend Cloud deployments offered by `bendsql cloud login`.
+	Endpoints map[string]*Endpoint `toml:"endpoints,omitempty"`
+	// Retry tunes retries of failed Databend Cloud API requests.
+	Retry *RetryConfig `toml:"retry,omitempty"`
 }
 
-type Config struct {
+// RetryConfig is the [retry] table of config.toml, durations use Go syntax
+// such as 500ms or 2m.
+type RetryConfig struct {
+	// Attempts is the maximum number of attempts of a request, 1 disables retries.
+	Attempts int `toml:"attempts,omitempty"`
+	// Delay is the wait before the first retry, it doubles for every retry.
+	Delay string `toml:"delay,omitempty"`
+	// MaxDelay caps the wait between two attempts unless the server asks
+	// for a longer one with Retry-After.
+	MaxDelay string `toml:"max_delay,omitempty"`
+	// MaxElapsed is the time after which no more attempts are started.
+	MaxElapsed string `toml:"max_elapsed,omitempty"`
+}
+
+// Profile is a named connection, stored as [profiles.NAME] in config.toml.
+type Profile struct {
 	Target    string           `toml:"target"`
 	Cloud     *CloudConfig     `toml:"cloud,omitempty"`
 	Community *CommunityConfig `toml:"community,omitempty"`
 }
 
+// SetProfile selects the profile used by this process regardless of
+// BENDSQL_PROFILE and the current_profile saved in config.toml.
+func SetProfile(name string) {
+	profileOverride = name
+}
+
+// ActiveProfile returns the name of the profile commands should operate on.
+func (c *Config) ActiveProfile() string {
+	if profileOverride != "" {
+		return profileOverride
+	}
+	if a := os.Getenv("BENDSQL_PROFILE"); a != "" {
+		return a
+	}
+	if c.CurrentProfile != "" {
+		return c.CurrentProfile
+	}
+	return DefaultProfile
+}
+
+// Profile returns the profile with the given name.
+func (c *Config) Profile(name string) (*Profile, error) {
+	p, ok := c.Profiles[name]
+	if !ok {
+		return nil, errors.Errorf("profile %s not found", name)
+	}
+	return p, nil
+}
+
+// UpsertProfile returns the profile with the given name, creating it if needed.
+func (c *Config) UpsertProfile(name string) *Profile {
+	if c.Profiles == nil {
+		c.Profiles = make(map[string]*Profile)
+	}
+	p, ok := c.Profiles[name]
+	if !ok {
+		p = &Profile{}
+		c.Profiles[name] = p
+	}
+	if c.CurrentProfile == "" {
+		c.CurrentProfile = name
+	}
+	return p
+}
+
+// ProfileNames returns all profile names in alphabetical order.
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (c *Config) UseProfile(name string) error {
+	if _, err := c.Profile(name); err != nil {
+		return err
+	}
+	c.CurrentProfile = name
+	return nil
+}
+
+func (c *Config) RenameProfile(oldName, newName string) error {
+	p, err := c.Profile(oldName)
+	if err != nil {
+		return err
+	}
+	if newName == "" {
+		return errors.New("profile name can not be empty")
+	}
+	if _, ok := c.Profiles[newName]; ok {
+		return errors.Errorf("profile %s already exists", newName)
+	}
+	if err := p.renameSecrets(oldName, newName); err != nil {
+		return err
+	}
+	delete(c.Profiles, oldName)
+	c.Profiles[newName] = p
+	if c.CurrentProfile == oldName {
+		c.CurrentProfile = newName
+	}
+	return nil
+}
+
+func (c *Config) RemoveProfile(name string) error {
+	p, err := c.Profile(name)
+	if err != nil {
+		return err
+	}
+	if err := p.removeSecrets(name); err != nil {
+		return err
+	}
+	delete(c.Profiles, name)
+	if c.CurrentProfile == name {
+		c.CurrentProfile = ""
+	}
+	return nil
+}
+
 func (c *Config) GetDSN(opts RuntimeOptions) (string, error) {
-	switch c.Target {
+	name := c.ActiveProfile()
+	if _, ok := c.Profiles[name]; !ok && name != DefaultProfile {
+		return "", errors.Errorf("profile %s not found, please use `bendsql profile ls` to list profiles", name)
+	}
+	p, _, err := c.Resolve()
+	if err != nil {
+		return "", err
+	}
+	var token *Token
+	if p.Cloud != nil {
+		token = p.Cloud.Token
+	}
+	dsn, err := p.GetDSN(opts)
+	// Resolve returns a copy, keep a renewed token for the next connection
+	if stored := c.Profiles[name]; stored != nil && stored.Cloud != nil && p.Cloud != nil && p.Cloud.Token != token {
+		stored.Cloud.Token = p.Cloud.Token
+	}
+	if err != nil && p.Target != "" {
+		return "", errors.Wrapf(err, "profile %s", name)
+	}
+	return dsn, err
+}
+
+func (p *Profile) GetDSN(opts RuntimeOptions) (string, error) {
+	switch p.Target {
 	case TARGET_COMMUNITY:
-		if c.Community == nil {
+		if p.Community == nil {
 			return "", errors.New("please use `bendsql connect` to connect to your instance first")
 		}
-		return c.Community.GetDSN(opts)
+		return p.Community.GetDSN(opts)
 	case TARGET_CLOUD:
-		if c.Cloud == nil {
+		if p.Cloud == nil {
 			return "", errors.New("please use `bendsql cloud login` to connect to your account first")
 		}
-		return c.Cloud.GetDSN(opts)
+		return p.Cloud.GetDSN(opts)
 	default:
 		return "", errors.New("please use `bendsql connect` or `bendsql cloud login` to connect to your instance first")
 	}
@@ -91,6 +234,8 @@ type CommunityConfig struct {
 	Password string `toml:"password"`
 	Database string `toml:"database"`
 	SSL      bool   `toml:"ssl"`
+	// TLS customizes verification when SSL is enabled.
+	TLS *TLSConfig `toml:"tls,omitempty"`
 
 	Options map[string]string `toml:"options"`
 }
@@ -106,7 +251,11 @@ func (c *CommunityConfig) GetDSN(opts RuntimeOptions) (string, error) {
 	if opts.Password != "" {
 		cfg.Password = opts.Password
 	} else {
-		cfg.Password = c.Password
+		password, err := ResolveSecret(c.Password)
+		if err != nil {
+			return "", errors.Wrap(err, "resolve community.password")
+		}
+		cfg.Password = password
 	}
 	if opts.Database != "" {
 		cfg.Database = opts.Database
@@ -116,11 +265,29 @@ func (c *CommunityConfig) GetDSN(opts RuntimeOptions) (string, error) {
 
 	if !c.SSL {
 		cfg.SSLMode = dc.SSL_MODE_DISABLE
+	} else if c.TLS != nil {
+		tlsConfig, err := c.TLS.Build()
+		if err != nil {
+			return "", errors.Wrap(err, "invalid community.tls")
+		}
+		cfg.TLSConfig, err = registerTLS(cfg.Host, tlsConfig)
+		if err != nil {
+			return "", err
+		}
+	}
+	params := make(map[string]string, len(c.Options))
+	for k, v := range c.Options {
+		value, err := ResolveSecret(v)
+		if err != nil {
+			return "", errors.Wrapf(err, "resolve community.options.%s", k)
+		}
+		params[k] = value
+	}
+	if err := cfg.AddParams(params); err != nil {
+		return "", errors.Wrap(err, "invalid community.options")
 	}
-	cfg.AddParams(c.Options)
 
-	dsn := cfg.FormatDSN()
-	return dsn, nil
+	return formatDSN(cfg), nil
 }
 
 type CloudConfig struct {
@@ -129,12 +296,22 @@ type CloudConfig struct {
 	Warehouse string `toml:"warehouse"`
 	Gateway   string `toml:"gateway"`
 	Endpoint  string `toml:"endpoint"`
+	// Account is the email of the account logged in to, see AccountKey.
+	Account string `toml:"account,omitempty"`
 
 	Token *Token `toml:"token,omitempty"`
+
+	// Accounts are the other accounts logged in to in this profile, keyed by
+	// AccountKey. They are switched to with `bendsql cloud account switch`.
+	Accounts map[string]*CloudConfig `toml:"accounts,omitempty"`
 }
 
 func (c *CloudConfig) GetDSN(opts RuntimeOptions) (string, error) {
-	if c.Token == nil {
+	token := c.Token
+	if t := EnvToken(); t != nil {
+		token = t
+	}
+	if token == nil {
 		return "", errors.New("please use `bendsql cloud login` to login your account first")
 	}
 	if c.Gateway == "" || c.Tenant == "" || c.Warehouse == "" {
@@ -152,54 +329,234 @@ func (c *CloudConfig) GetDSN(opts RuntimeOptions) (string, error) {
 	if opts.Username != "" {
 		cfg.User = opts.Username
 		cfg.Password = opts.Password
-	} else {
-		cfg.AccessToken = c.Token.AccessToken
 	}
 	if opts.Database != "" {
 		cfg.Database = opts.Database
 	}
 
-	cfg.AccessToken = c.Token.AccessToken
+	accessToken, err := ResolveSecret(token.AccessToken)
+	if err != nil {
+		return "", errors.Wrap(err, "resolve cloud.token.access_token")
+	}
+	if token.NeedsRefresh() && tokenRefreshFunc != nil {
+		fresh, err := tokenRefreshFunc()
+		if err != nil {
+			return "", errors.Wrap(err, "refresh cloud token")
+		}
+		accessToken = fresh.AccessToken
+		if token == c.Token {
+			// the renewed token is saved by tokenRefreshFunc, this keeps it
+			// for the next call
+			c.Token = fresh
+		}
+	}
+	cfg.AccessToken = accessToken
 
 	dsn := cfg.FormatDSN()
 	return dsn, nil
 }
 
+// Token is a session token of `bendsql cloud login`, or an API key or
+// personal access token which has no refresh token and never expires.
 type Token struct {
 	AccessToken  string    `toml:"access_token"`
 	RefreshToken string    `toml:"refresh_token"`
 	ExpiresAt    time.Time `toml:"expires_at"`
 }
 
+// TokenEnv holds an API key or personal access token that is used instead of
+// the stored token, for CI.
+const TokenEnv = "BENDSQL_TOKEN"
+
+// EnvToken returns the token set in BENDSQL_TOKEN, nil if there is none.
+func EnvToken() *Token {
+	if t := os.Getenv(TokenEnv); t != "" {
+		return &Token{AccessToken: t}
+	}
+	return nil
+}
+
+// Refreshable reports whether t is a session token that can be renewed.
+func (t *Token) Refreshable() bool {
+	return t.RefreshToken != ""
+}
+
+// TokenRefreshSkew is how long before it expires a token is renewed, so that
+// it doesn't expire in the middle of a query.
+const TokenRefreshSkew = 5 * time.Minute
+
+// NeedsRefresh reports whether t can be renewed and expires within
+// TokenRefreshSkew, tokens with an unknown expiry are not renewed.
+func (t *Token) NeedsRefresh() bool {
+	return t.Refreshable() && !t.ExpiresAt.IsZero() && time.Now().Add(TokenRefreshSkew).After(t.ExpiresAt)
+}
+
+var tokenRefreshFunc func() (*Token, error)
+
+// SetTokenRefreshFunc sets how the expiring token of the active profile is
+// renewed by GetDSN, config can't use the api client itself.
+func SetTokenRefreshFunc(fn func() (*Token, error)) {
+	tokenRefreshFunc = fn
+}
+
 type RuntimeOptions struct {
 	Username string
 	Password string
 	Database string
 }
 
+// SetPath sets the location of config.toml regardless of BENDSQL_CONFIG.
+func SetPath(path string) {
+	configFile = path
+}
+
+// SetEphemeral enables a mode in which config.toml and the credential vault
+// are never written, for read-only file systems and throwaway containers.
+func SetEphemeral(enabled bool) {
+	ephemeral = enabled
+}
+
+func IsEphemeral() bool {
+	return ephemeral
+}
+
+// Path returns the location of config.toml, it is empty when neither
+// --config, BENDSQL_CONFIG nor the home directory is available.
+func Path() string {
+	if configFile != "" {
+		return configFile
+	}
+	if a := os.Getenv("BENDSQL_CONFIG"); a != "" {
+		return a
+	}
+	d, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(d, ".config", "bendsql", "config.toml")
+}
+
+// GetConfig reads config.toml, a missing file is an empty config. Files of
+// an older version are migrated and saved with a backup copy.
 func GetConfig() (*Config, error) {
-	content, err := os.ReadFile(configFile)
+	cfg, version, err := readConfig()
+	if err != nil || version == CurrentVersion || ephemeral {
+		return cfg, err
+	}
+	if _, err := Migrate(); err != nil {
+		// a read-only config file is still usable after migrating it in memory
+		logrus.Warnf("failed to upgrade config file %s: %v", Path(), err)
+	}
+	return cfg, nil
+}
+
+// readConfig reads and migrates config.toml without writing it, version is
+// the version of the file on disk.
+func readConfig() (*Config, int, error) {
+	path := Path()
+	if path == "" || !exists(path) {
+		return &Config{Version: CurrentVersion}, CurrentVersion, nil
+	}
+	warnWorldReadable(path)
+	content, err := os.ReadFile(path)
 	if err != nil {
-		return nil, errors.Wrap(err, "read config file")
+		return nil, 0, errors.Wrap(err, "read config file")
 	}
-	var cfg Config
-	_, err = toml.Decode(string(content), &cfg)
+	cfg, version, _, err := decodeConfig(content)
 	if err != nil {
-		return nil, errors.Wrap(err, "unmarshal config file")
+		return nil, 0, errors.Wrapf(err, "config file %s", path)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, 0, errors.Wrapf(err, "invalid config file %s", path)
 	}
-	return &cfg, nil
+	return cfg, version, nil
 }
 
+// WriteConfig saves cfg to config.toml, creating the file when needed. The
+// file is replaced atomically, readers never see a partially written file.
 func WriteConfig(cfg *Config) error {
-	file, err := os.OpenFile(configFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if ephemeral {
+		return nil
+	}
+	path := Path()
+	if path == "" {
+		return errNoConfigPath
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errors.Wrap(err, "create config directory")
+	}
+	content, err := encodeConfig(cfg)
 	if err != nil {
-		return errors.Wrap(err, "open config file")
+		return err
 	}
-	err = toml.NewEncoder(file).Encode(cfg)
+	return errors.Wrap(writeFileAtomic(path, content), "write config file")
+}
+
+func encodeConfig(cfg *Config) ([]byte, error) {
+	cfg.Version = CurrentVersion
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(cfg); err != nil {
+		return nil, errors.Wrap(err, "encode config file")
+	}
+	return buf.Bytes(), nil
+}
+
+// writeFileAtomic writes content to a temporary file with mode 0600 next to
+// path and renames it over path.
+func writeFileAtomic(path string, content []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
 	if err != nil {
-		return errors.Wrap(err, "encode config file")
+		return err
 	}
-	return nil
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+var worldReadableWarned = false
+
+// warnWorldReadable warns once about config files written by older versions
+// with mode 0644, WriteConfig tightens them to 0600.
+func warnWorldReadable(path string) {
+	if worldReadableWarned || runtime.GOOS == "windows" {
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	if info.Mode().Perm()&0004 != 0 {
+		worldReadableWarned = true
+		logrus.Warnf("config file %s is readable by other users, please run `chmod 600 %s`", path, path)
+	}
+}
+
+// formatDSN is cfg.FormatDSN including the driver params it leaves out.
+func formatDSN(cfg *dc.Config) string {
+	dsn := cfg.FormatDSN()
+	if len(cfg.Params) == 0 {
+		return dsn
+	}
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return dsn
+	}
+	query := u.Query()
+	for k, v := range cfg.Params {
+		query.Set(k, v)
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
 }
 
 func exists(path string) bool {
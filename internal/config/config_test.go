@@ -0,0 +1,133 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestActiveProfile(t *testing.T) {
+	cfg := &Config{}
+	assert.Equal(t, DefaultProfile, cfg.ActiveProfile())
+
+	cfg.CurrentProfile = "staging"
+	assert.Equal(t, "staging", cfg.ActiveProfile())
+
+	t.Setenv("BENDSQL_PROFILE", "prod-cn")
+	assert.Equal(t, "prod-cn", cfg.ActiveProfile())
+
+	SetProfile("dev")
+	t.Cleanup(func() { SetProfile("") })
+	assert.Equal(t, "dev", cfg.ActiveProfile())
+}
+
+func TestProfileLifecycle(t *testing.T) {
+	cfg := &Config{}
+	p := cfg.UpsertProfile("staging")
+	p.Target = TARGET_COMMUNITY
+	p.Community = &CommunityConfig{Host: "staging.internal", Port: 8000, User: "root"}
+	cfg.UpsertProfile("prod").Target = TARGET_CLOUD
+	assert.Equal(t, "staging", cfg.CurrentProfile)
+	assert.Equal(t, []string{"prod", "staging"}, cfg.ProfileNames())
+
+	dsn, err := cfg.GetDSN(RuntimeOptions{})
+	assert.NoError(t, err)
+	assert.Contains(t, dsn, "staging.internal:8000")
+
+	assert.Error(t, cfg.RenameProfile("staging", "prod"))
+	assert.NoError(t, cfg.RenameProfile("staging", "qa"))
+	assert.Equal(t, "qa", cfg.CurrentProfile)
+
+	assert.NoError(t, cfg.UseProfile("prod"))
+	assert.Error(t, cfg.UseProfile("staging"))
+
+	assert.NoError(t, cfg.RemoveProfile("prod"))
+	assert.Equal(t, "", cfg.CurrentProfile)
+	assert.Equal(t, []string{"qa"}, cfg.ProfileNames())
+
+	SetProfile("missing")
+	t.Cleanup(func() { SetProfile("") })
+	_, err = cfg.GetDSN(RuntimeOptions{})
+	assert.EqualError(t, err, "profile missing not found, please use `bendsql profile ls` to list profiles")
+}
+
+func TestLoadAndWriteConfig(t *testing.T) {
+	dir := useTempConfig(t)
+	configFile = filepath.Join(dir, "nested", "config.toml")
+
+	cfg, err := GetConfig()
+	assert.NoError(t, err)
+	assert.Empty(t, cfg.Profiles)
+	_, err = os.Stat(configFile)
+	assert.True(t, os.IsNotExist(err), "loading must not create the config file")
+
+	cfg.UpsertProfile("default").Target = TARGET_COMMUNITY
+	SetEphemeral(true)
+	assert.NoError(t, WriteConfig(cfg))
+	_, err = os.Stat(configFile)
+	assert.True(t, os.IsNotExist(err), "ephemeral mode must not write the config file")
+
+	SetEphemeral(false)
+	assert.NoError(t, WriteConfig(cfg))
+	cfg, err = GetConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, TARGET_COMMUNITY, cfg.Profiles["default"].Target)
+}
+
+func TestGetDSNRefreshesToken(t *testing.T) {
+	c := &CloudConfig{
+		Gateway:   "gw.example.com",
+		Tenant:    "tn",
+		Warehouse: "wh",
+		Token:     &Token{AccessToken: "old", RefreshToken: "r", ExpiresAt: time.Now().Add(time.Minute)},
+	}
+	refreshed := 0
+	SetTokenRefreshFunc(func() (*Token, error) {
+		refreshed++
+		return &Token{AccessToken: "new", RefreshToken: "r2", ExpiresAt: time.Now().Add(time.Hour)}, nil
+	})
+	defer SetTokenRefreshFunc(nil)
+
+	dsn, err := c.GetDSN(RuntimeOptions{})
+	assert.NoError(t, err)
+	assert.Contains(t, dsn, "access_token=new")
+	assert.Equal(t, 1, refreshed)
+
+	// the renewed token is used until it expires
+	dsn, err = c.GetDSN(RuntimeOptions{})
+	assert.NoError(t, err)
+	assert.Contains(t, dsn, "access_token=new")
+	assert.Equal(t, 1, refreshed)
+
+	cfg := &Config{Profiles: map[string]*Profile{DefaultProfile: {Target: TARGET_CLOUD, Cloud: c}}}
+	c.Token = &Token{AccessToken: "old", RefreshToken: "r", ExpiresAt: time.Now().Add(time.Minute)}
+	for i := 0; i < 2; i++ {
+		dsn, err = cfg.GetDSN(RuntimeOptions{})
+		assert.NoError(t, err)
+		assert.Contains(t, dsn, "access_token=new")
+	}
+	assert.Equal(t, 2, refreshed)
+
+	// api keys have nothing to renew them with
+	c.Token = &Token{AccessToken: "key"}
+	_, err = c.GetDSN(RuntimeOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, refreshed)
+}
@@ -0,0 +1,407 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/google/shlex"
+	"github.com/pkg/errors"
+)
+
+const (
+	CredentialStoreVault     = "vault"
+	CredentialStorePlaintext = "plaintext"
+)
+
+// CredentialStore keeps secrets out of config.toml, which only holds
+// references in the form "ref:<store>:<key>".
+type CredentialStore interface {
+	Get(key string) (string, error)
+	Set(key, value string) error
+	Delete(key string) error
+}
+
+var (
+	// secretResolvers resolve references to secrets bendsql does not store itself.
+	secretResolvers = map[string]func(string) (string, error){
+		"env":  resolveEnv,
+		"file": resolveFile,
+		"cmd":  resolveCmd,
+	}
+	credentialStores = map[string]func() (CredentialStore, error){
+		CredentialStoreVault: openVault,
+	}
+	openedStores = map[string]CredentialStore{}
+)
+
+// RegisterCredentialStore makes a credential store available under name, so
+// that "ref:name:key" references in config.toml are resolved through it.
+func RegisterCredentialStore(name string, open func() (CredentialStore, error)) {
+	credentialStores[name] = open
+	delete(openedStores, name)
+}
+
+func getCredentialStore(name string) (CredentialStore, error) {
+	if s, ok := openedStores[name]; ok {
+		return s, nil
+	}
+	open, ok := credentialStores[name]
+	if !ok {
+		return nil, errors.Errorf("unknown credential store %s", name)
+	}
+	s, err := open()
+	if err != nil {
+		return nil, errors.Wrapf(err, "open credential store %s", name)
+	}
+	openedStores[name] = s
+	return s, nil
+}
+
+// secretRefPrefix marks references, e.g. "ref:env:DATABEND_PASS" or
+// "ref:vault:profiles.default.community.password". Without it a password such
+// as "cmd:abc" or "vault:abc" could not be told apart from a reference.
+const secretRefPrefix = "ref:"
+
+// literalPrefix escapes literal secrets starting with secretRefPrefix that are
+// kept in config.toml as they are.
+const literalPrefix = secretRefPrefix + "literal:"
+
+// storeRef returns the reference to key in store.
+func storeRef(store, key string) string {
+	return secretRefPrefix + store + ":" + key
+}
+
+// parseSecretRef splits a "ref:<store>:<key>" reference, ok is false for
+// literal values.
+func parseSecretRef(value string) (store, key string, ok bool) {
+	if !strings.HasPrefix(value, secretRefPrefix) {
+		return "", "", false
+	}
+	ref := strings.TrimPrefix(value, secretRefPrefix)
+	i := strings.Index(ref, ":")
+	if i <= 0 {
+		return "", "", false
+	}
+	if _, ok := credentialStores[ref[:i]]; !ok {
+		return "", "", false
+	}
+	return ref[:i], ref[i+1:], true
+}
+
+// SecretRef validates a reference given as env:NAME, file:PATH or
+// cmd:COMMAND and returns the value to keep in config.toml for it.
+func SecretRef(ref string) (string, error) {
+	if _, _, ok := parseResolverRef(secretRefPrefix + ref); !ok {
+		return "", errors.Errorf("invalid secret reference %q, expected env:NAME, file:PATH or cmd:COMMAND", ref)
+	}
+	return secretRefPrefix + ref, nil
+}
+
+// parseResolverRef splits a "ref:<resolver>:<arg>" reference.
+func parseResolverRef(value string) (resolve func(string) (string, error), arg string, ok bool) {
+	if !strings.HasPrefix(value, secretRefPrefix) {
+		return nil, "", false
+	}
+	ref := strings.TrimPrefix(value, secretRefPrefix)
+	i := strings.Index(ref, ":")
+	if i <= 0 {
+		return nil, "", false
+	}
+	resolve, ok = secretResolvers[ref[:i]]
+	return resolve, ref[i+1:], ok
+}
+
+// IsSecretRef reports whether value is a reference instead of a literal secret.
+func IsSecretRef(value string) bool {
+	if _, _, ok := parseResolverRef(value); ok {
+		return true
+	}
+	_, _, ok := parseSecretRef(value)
+	return ok
+}
+
+// ResolveSecret returns the secret a config value refers to, literal values
+// are returned unchanged. Besides credential stores it understands
+// ref:env:NAME, ref:file:PATH and ref:cmd:COMMAND references.
+func ResolveSecret(value string) (string, error) {
+	if strings.HasPrefix(value, literalPrefix) {
+		return strings.TrimPrefix(value, literalPrefix), nil
+	}
+	if resolve, arg, ok := parseResolverRef(value); ok {
+		return resolve(arg)
+	}
+	store, key, ok := parseSecretRef(value)
+	if !ok {
+		return value, nil
+	}
+	s, err := getCredentialStore(store)
+	if err != nil {
+		return "", err
+	}
+	secret, err := s.Get(key)
+	if err != nil {
+		return "", errors.Wrapf(err, "read secret %s", key)
+	}
+	return secret, nil
+}
+
+// DeleteSecret removes the secret value refers to from its credential store,
+// literal values and ref: references are left alone.
+func DeleteSecret(value string) error {
+	store, key, ok := parseSecretRef(value)
+	if !ok {
+		return nil
+	}
+	s, err := getCredentialStore(store)
+	if err != nil {
+		return err
+	}
+	return errors.Wrapf(s.Delete(key), "delete secret %s", key)
+}
+
+// credentialStore returns the name of the store new secrets are saved to.
+func (c *Config) credentialStore() string {
+	if c.CredentialStore == "" {
+		return CredentialStoreVault
+	}
+	return c.CredentialStore
+}
+
+// CheckCredentialStore returns an error when saving a secret would have to
+// ask for the vault passphrase, so that commands running without a terminal
+// fail before doing any work instead of when saving their result.
+func (c *Config) CheckCredentialStore() error {
+	if ephemeral || c.credentialStore() != CredentialStoreVault || os.Getenv("BENDSQL_VAULT_PASSPHRASE") != "" {
+		return nil
+	}
+	if _, ok := openedStores[CredentialStoreVault]; ok {
+		return nil
+	}
+	return errors.New("secrets are saved to the credential vault, please set BENDSQL_VAULT_PASSPHRASE " +
+		"or run `bendsql config set credential_store plaintext` when not running interactively")
+}
+
+// SealSecret saves value under key in the configured credential store and
+// returns the reference to keep in config.toml instead of the value. value
+// is always a literal, references are saved with SetSecretRef.
+func (c *Config) SealSecret(key, value string) (string, error) {
+	if value == "" || ephemeral || c.credentialStore() == CredentialStorePlaintext {
+		if strings.HasPrefix(value, secretRefPrefix) {
+			return literalPrefix + value, nil
+		}
+		return value, nil
+	}
+	store := c.credentialStore()
+	s, err := getCredentialStore(store)
+	if err != nil {
+		return "", err
+	}
+	if err := s.Set(key, value); err != nil {
+		return "", errors.Wrapf(err, "save secret %s", key)
+	}
+	return storeRef(store, key), nil
+}
+
+// SealToken is SealSecret for both parts of the cloud token of the account
+// with the given AccountKey in profile.
+func (c *Config) SealToken(profile, account string, t *Token) (*Token, error) {
+	if t == nil {
+		return nil, nil
+	}
+	sealed := *t
+	var err error
+	// every account needs its own keys, switching accounts keeps the references
+	prefix := "profiles." + profile + ".cloud.accounts." + account + ".token."
+	sealed.AccessToken, err = c.SealSecret(prefix+"access_token", t.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+	sealed.RefreshToken, err = c.SealSecret(prefix+"refresh_token", t.RefreshToken)
+	if err != nil {
+		return nil, err
+	}
+	return &sealed, nil
+}
+
+// RemoveToken removes the cloud token of profile and deletes its secrets from
+// the credential store. The token is removed even if deleting them fails.
+func (c *Config) RemoveToken(profile string) error {
+	p, ok := c.Profiles[profile]
+	if !ok || p.Cloud == nil || p.Cloud.Token == nil {
+		return nil
+	}
+	t := p.Cloud.Token
+	p.Cloud.Token = nil
+	for _, value := range []string{t.AccessToken, t.RefreshToken} {
+		if err := DeleteSecret(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// eachSecret replaces every secret value of p, including the tokens of its
+// other accounts, with the result of fn. Empty values are skipped.
+func (p *Profile) eachSecret(fn func(value string) (string, error)) error {
+	update := func(value *string) error {
+		if *value == "" {
+			return nil
+		}
+		v, err := fn(*value)
+		if err != nil {
+			return err
+		}
+		*value = v
+		return nil
+	}
+	if c := p.Community; c != nil {
+		if err := update(&c.Password); err != nil {
+			return err
+		}
+		for k, v := range c.Options {
+			if err := update(&v); err != nil {
+				return err
+			}
+			c.Options[k] = v
+		}
+	}
+	var cloud func(c *CloudConfig) error
+	cloud = func(c *CloudConfig) error {
+		if c == nil {
+			return nil
+		}
+		if t := c.Token; t != nil {
+			if err := update(&t.AccessToken); err != nil {
+				return err
+			}
+			if err := update(&t.RefreshToken); err != nil {
+				return err
+			}
+		}
+		for _, account := range c.Accounts {
+			if err := cloud(account); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return cloud(p.Cloud)
+}
+
+// removeSecrets deletes the secrets of p saved under the keys of profile
+// name from their credential stores.
+func (p *Profile) removeSecrets(name string) error {
+	prefix := "profiles." + name + "."
+	return p.eachSecret(func(value string) (string, error) {
+		if _, key, ok := parseSecretRef(value); !ok || !strings.HasPrefix(key, prefix) {
+			return value, nil
+		}
+		return "", DeleteSecret(value)
+	})
+}
+
+// renameSecrets moves the secrets of p saved under the keys of profile
+// oldName to the keys of newName, so that they neither leak into nor get
+// overwritten by a new profile named oldName. The old keys are deleted once
+// all secrets are copied.
+func (p *Profile) renameSecrets(oldName, newName string) error {
+	oldPrefix := "profiles." + oldName + "."
+	var moved []string
+	err := p.eachSecret(func(value string) (string, error) {
+		store, key, ok := parseSecretRef(value)
+		if !ok || !strings.HasPrefix(key, oldPrefix) {
+			return value, nil
+		}
+		s, err := getCredentialStore(store)
+		if err != nil {
+			return "", err
+		}
+		secret, err := s.Get(key)
+		if err != nil {
+			return "", errors.Wrapf(err, "read secret %s", key)
+		}
+		newKey := "profiles." + newName + "." + strings.TrimPrefix(key, oldPrefix)
+		if err := s.Set(newKey, secret); err != nil {
+			return "", errors.Wrapf(err, "save secret %s", newKey)
+		}
+		moved = append(moved, value)
+		return storeRef(store, newKey), nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, value := range moved {
+		if err := DeleteSecret(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UnsealToken resolves the references of a token loaded from config.toml.
+func UnsealToken(t *Token) (*Token, error) {
+	if t == nil {
+		return nil, nil
+	}
+	unsealed := *t
+	var err error
+	unsealed.AccessToken, err = ResolveSecret(t.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+	unsealed.RefreshToken, err = ResolveSecret(t.RefreshToken)
+	if err != nil {
+		return nil, err
+	}
+	return &unsealed, nil
+}
+
+func resolveEnv(name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", errors.Errorf("environment variable %s is not set", name)
+	}
+	return value, nil
+}
+
+func resolveFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", errors.Wrapf(err, "read secret file %s", path)
+	}
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+func resolveCmd(command string) (string, error) {
+	args, err := shlex.Split(command)
+	if err != nil {
+		return "", errors.Wrapf(err, "parse secret command %q", command)
+	}
+	if len(args) == 0 {
+		return "", errors.New("secret command is empty")
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", errors.Wrapf(err, "run secret command %q: %s", command, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimRight(stdout.String(), "\r\n"), nil
+}
@@ -0,0 +1,250 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPBKDF2SHA256(t *testing.T) {
+	// RFC 7914 section 11
+	dk := pbkdf2SHA256([]byte("passwd"), []byte("salt"), 1, 64)
+	assert.Equal(t, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc"+
+		"49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783", hex.EncodeToString(dk))
+}
+
+func useTempConfig(t *testing.T) string {
+	dir := t.TempDir()
+	orig := configFile
+	configFile = filepath.Join(dir, "config.toml")
+	t.Cleanup(func() {
+		configFile = orig
+		openedStores = map[string]CredentialStore{}
+	})
+	return dir
+}
+
+func TestSealSecret(t *testing.T) {
+	dir := useTempConfig(t)
+	t.Setenv("BENDSQL_VAULT_PASSPHRASE", "correct horse")
+
+	cfg := &Config{}
+	ref, err := cfg.SealSecret("profiles.default.community.password", "s3cret")
+	assert.NoError(t, err)
+	assert.Equal(t, "ref:vault:profiles.default.community.password", ref)
+
+	info, err := os.Stat(filepath.Join(dir, "credentials.vault"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// reopen the vault from disk
+	openedStores = map[string]CredentialStore{}
+	secret, err := ResolveSecret(ref)
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cret", secret)
+
+	openedStores = map[string]CredentialStore{}
+	t.Setenv("BENDSQL_VAULT_PASSPHRASE", "wrong")
+	_, err = ResolveSecret(ref)
+	assert.EqualError(t, err, "open credential store vault: wrong vault passphrase")
+
+	literal, err := ResolveSecret("plain:text")
+	assert.NoError(t, err)
+	assert.Equal(t, "plain:text", literal)
+}
+
+func TestVaultKeepsConcurrentChanges(t *testing.T) {
+	useTempConfig(t)
+	t.Setenv("BENDSQL_VAULT_PASSPHRASE", "correct horse")
+
+	first, err := openVault()
+	assert.NoError(t, err)
+	assert.NoError(t, first.Set("a", "1"))
+
+	// a second process opens the vault and changes it
+	second, err := openVault()
+	assert.NoError(t, err)
+	assert.NoError(t, second.Set("b", "2"))
+
+	assert.NoError(t, first.Set("c", "3"))
+	for key, want := range map[string]string{"a": "1", "b": "2", "c": "3"} {
+		value, err := second.Get(key)
+		assert.NoError(t, err)
+		assert.Equal(t, want, value)
+	}
+}
+
+func TestRemoveToken(t *testing.T) {
+	useTempConfig(t)
+	t.Setenv("BENDSQL_VAULT_PASSPHRASE", "correct horse")
+
+	cfg := &Config{}
+	token, err := cfg.SealToken("default", "app.databend.com/alice@example.com", &Token{AccessToken: "a", RefreshToken: "r"})
+	assert.NoError(t, err)
+	cfg.UpsertProfile("default").Cloud = &CloudConfig{Token: token}
+
+	assert.NoError(t, cfg.RemoveToken("default"))
+	assert.Nil(t, cfg.Profiles["default"].Cloud.Token)
+	_, err = ResolveSecret(token.AccessToken)
+	assert.Error(t, err)
+	assert.NoError(t, cfg.RemoveToken("missing"))
+}
+
+func TestRenameProfileMovesSecrets(t *testing.T) {
+	useTempConfig(t)
+	t.Setenv("BENDSQL_VAULT_PASSPHRASE", "correct horse")
+
+	cfg := &Config{}
+	password, err := cfg.SealSecret("profiles.old.community.password", "s3cret")
+	assert.NoError(t, err)
+	cfg.UpsertProfile("old").Community = &CommunityConfig{Password: password}
+	token, err := cfg.SealToken("old", "app.databend.com/alice@example.com", &Token{AccessToken: "a", RefreshToken: "r"})
+	assert.NoError(t, err)
+	cfg.UpsertProfile("cloud").Cloud = &CloudConfig{Token: token}
+	assert.NoError(t, cfg.RenameProfile("cloud", "tmp"))
+	assert.Equal(t, token, cfg.Profiles["tmp"].Cloud.Token, "secrets of other profiles are kept")
+	assert.NoError(t, cfg.RemoveProfile("tmp"))
+	secret, err := ResolveSecret(token.AccessToken)
+	assert.NoError(t, err)
+	assert.Equal(t, "a", secret)
+
+	assert.NoError(t, cfg.RenameProfile("old", "new"))
+	renamed := cfg.Profiles["new"].Community.Password
+	assert.Equal(t, "ref:vault:profiles.new.community.password", renamed)
+
+	// a new profile reusing the old name must not share the secret
+	reused, err := cfg.SealSecret("profiles.old.community.password", "other")
+	assert.NoError(t, err)
+	cfg.UpsertProfile("old").Community = &CommunityConfig{Password: reused}
+	secret, err = ResolveSecret(renamed)
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cret", secret)
+
+	assert.NoError(t, cfg.RemoveProfile("new"))
+	_, err = ResolveSecret(renamed)
+	assert.Error(t, err)
+	secret, err = ResolveSecret(reused)
+	assert.NoError(t, err)
+	assert.Equal(t, "other", secret)
+}
+
+func TestSealSecretPlaintext(t *testing.T) {
+	useTempConfig(t)
+	cfg := &Config{CredentialStore: CredentialStorePlaintext}
+	token, err := cfg.SealToken("default", "app.databend.com/alice@example.com", &Token{AccessToken: "a", RefreshToken: "r"})
+	assert.NoError(t, err)
+	assert.Equal(t, "a", token.AccessToken)
+	assert.Equal(t, "r", token.RefreshToken)
+}
+
+func TestResolveSecretReferences(t *testing.T) {
+	t.Setenv("DATABEND_PASS", "from-env")
+	secret, err := ResolveSecret("ref:env:DATABEND_PASS")
+	assert.NoError(t, err)
+	assert.Equal(t, "from-env", secret)
+
+	_, err = ResolveSecret("ref:env:BENDSQL_TEST_MISSING")
+	assert.EqualError(t, err, "environment variable BENDSQL_TEST_MISSING is not set")
+
+	path := filepath.Join(t.TempDir(), "db")
+	assert.NoError(t, os.WriteFile(path, []byte("from-file\n"), 0600))
+	secret, err = ResolveSecret("ref:file:" + path)
+	assert.NoError(t, err)
+	assert.Equal(t, "from-file", secret)
+
+	secret, err = ResolveSecret("ref:cmd:echo from-cmd")
+	assert.NoError(t, err)
+	assert.Equal(t, "from-cmd", secret)
+
+	assert.True(t, IsSecretRef("ref:cmd:pass show databend/prod"))
+	assert.False(t, IsSecretRef("p@ss:word"))
+
+	// passwords that look like references are literals and never run
+	assert.False(t, IsSecretRef("cmd:touch pwned"))
+	secret, err = ResolveSecret("cmd:touch pwned")
+	assert.NoError(t, err)
+	assert.Equal(t, "cmd:touch pwned", secret)
+
+	ref, err := SecretRef("env:DATABEND_PASS")
+	assert.NoError(t, err)
+	assert.Equal(t, "ref:env:DATABEND_PASS", ref)
+	_, err = SecretRef("hunter2")
+	assert.EqualError(t, err, `invalid secret reference "hunter2", expected env:NAME, file:PATH or cmd:COMMAND`)
+}
+
+func TestSealSecretLooksLikeReference(t *testing.T) {
+	useTempConfig(t)
+	t.Setenv("BENDSQL_VAULT_PASSPHRASE", "correct horse")
+
+	cfg := &Config{}
+	ref, err := cfg.SealSecret("profiles.default.community.password", "cmd:abc")
+	assert.NoError(t, err)
+	assert.Equal(t, "ref:vault:profiles.default.community.password", ref)
+	secret, err := ResolveSecret(ref)
+	assert.NoError(t, err)
+	assert.Equal(t, "cmd:abc", secret)
+}
+
+func TestPlaintextSecretLooksLikeReference(t *testing.T) {
+	useTempConfig(t)
+	t.Setenv("BENDSQL_VAULT_PASSPHRASE", "correct horse")
+
+	cfg := &Config{CredentialStore: CredentialStorePlaintext}
+	assert.False(t, IsSecretRef("vault:abc"))
+	value, err := cfg.SealSecret("profiles.default.community.password", "vault:abc")
+	assert.NoError(t, err)
+	assert.Equal(t, "vault:abc", value)
+	secret, err := ResolveSecret(value)
+	assert.NoError(t, err)
+	assert.Equal(t, "vault:abc", secret)
+	assert.NoError(t, DeleteSecret(value))
+	assert.Equal(t, secretMask, MaskSecret("community.password", value))
+
+	value, err = cfg.SealSecret("profiles.default.community.password", "ref:vault:abc")
+	assert.NoError(t, err)
+	assert.False(t, IsSecretRef(value))
+	secret, err = ResolveSecret(value)
+	assert.NoError(t, err)
+	assert.Equal(t, "ref:vault:abc", secret)
+	assert.Equal(t, secretMask, MaskSecret("community.password", value))
+}
+
+func TestGetDSNResolveError(t *testing.T) {
+	cfg := &Config{}
+	p := cfg.UpsertProfile("prod")
+	p.Target = TARGET_COMMUNITY
+	p.Community = &CommunityConfig{
+		Host:     "localhost",
+		Port:     8000,
+		User:     "root",
+		Password: "ref:env:DATABEND_PASS",
+		Options:  map[string]string{"max_rows": "ref:env:BENDSQL_TEST_MISSING"},
+	}
+	t.Setenv("DATABEND_PASS", "secret")
+
+	_, err := cfg.GetDSN(RuntimeOptions{})
+	assert.EqualError(t, err, "profile prod: resolve community.options.max_rows: environment variable BENDSQL_TEST_MISSING is not set")
+
+	t.Setenv("BENDSQL_TEST_MISSING", "100")
+	dsn, err := cfg.GetDSN(RuntimeOptions{})
+	assert.NoError(t, err)
+	assert.Contains(t, dsn, "root:secret@localhost:8000")
+	assert.Contains(t, dsn, "max_rows=100")
+}
@@ -0,0 +1,87 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"net/url"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// Endpoint is a Databend Cloud deployment registered with
+// `bendsql cloud endpoint add`, stored as [endpoints.NAME] in config.toml.
+type Endpoint struct {
+	URL string `toml:"url"`
+	// AuthMethods and Regions are discovered from the endpoint when it is added.
+	AuthMethods []string `toml:"auth_methods,omitempty"`
+	Regions     []string `toml:"regions,omitempty"`
+}
+
+// ParseEndpoint checks that endpoint is an http or https URL and returns it
+// without a trailing slash.
+func ParseEndpoint(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid endpoint %s", endpoint)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", errors.Errorf("invalid endpoint %s, it should look like https://app.databend.com", endpoint)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return "", errors.Errorf("invalid endpoint %s, it should not have a query or fragment", endpoint)
+	}
+	u.Path = ""
+	return u.String(), nil
+}
+
+// AddEndpoint registers endpoint under name, replacing the one of that name.
+func (c *Config) AddEndpoint(name string, endpoint *Endpoint) error {
+	if name == "" {
+		return errors.New("endpoint name can not be empty")
+	}
+	if c.Endpoints == nil {
+		c.Endpoints = make(map[string]*Endpoint)
+	}
+	c.Endpoints[name] = endpoint
+	return nil
+}
+
+func (c *Config) RemoveEndpoint(name string) error {
+	if _, ok := c.Endpoints[name]; !ok {
+		return errors.Errorf("endpoint %s not found", name)
+	}
+	delete(c.Endpoints, name)
+	return nil
+}
+
+// EndpointNames returns the names of the registered endpoints in alphabetical order.
+func (c *Config) EndpointNames() []string {
+	names := make([]string, 0, len(c.Endpoints))
+	for name := range c.Endpoints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// EndpointURL returns the URL of the endpoint registered as nameOrURL, other
+// values are returned unchanged.
+func (c *Config) EndpointURL(nameOrURL string) string {
+	if e, ok := c.Endpoints[nameOrURL]; ok {
+		return e.URL
+	}
+	return nameOrURL
+}
@@ -0,0 +1,232 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Sources of a resolved value, in increasing precedence.
+const (
+	SourceDefault = "default"
+	SourceProfile = "profile"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+const envPrefix = "BENDSQL_"
+
+// defaults apply to keys of a section that is configured but leaves them empty.
+var defaults = map[string]string{
+	"community.host":     "localhost",
+	"community.port":     "8000",
+	"community.user":     "root",
+	"community.database": "default",
+	"cloud.endpoint":     "https://app.databend.com",
+}
+
+// overrides are set with the global --override flag.
+var overrides = map[string]string{}
+
+// ResolvedValue is the effective value of a key and where it came from.
+type ResolvedValue struct {
+	Key    string
+	Value  string
+	Source string
+	// Origin names the profile, environment variable or flag the value was read from.
+	Origin string
+}
+
+// SetOverrides sets values from command line flags, they take precedence
+// over environment variables and profiles.
+func SetOverrides(values map[string]string) {
+	overrides = values
+}
+
+// EnvName returns the environment variable overriding key, e.g.
+// BENDSQL_COMMUNITY_HOST for community.host.
+func EnvName(key string) string {
+	return envPrefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(key))
+}
+
+// layeredKeys returns the keys of t that can be overridden, tokens are
+// session state and not layered.
+func layeredKeys(prefix string, t reflect.Type) []string {
+	var keys []string
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("toml"), ",")[0]
+		if tag == "" || tag == "-" {
+			continue
+		}
+		ft := t.Field(i).Type
+		switch {
+		case ft == reflect.TypeOf(&Token{}):
+		case ft.Kind() == reflect.Ptr:
+			keys = append(keys, layeredKeys(prefix+tag+".", ft.Elem())...)
+		case ft.Kind() == reflect.Map:
+		default:
+			keys = append(keys, prefix+tag)
+		}
+	}
+	return keys
+}
+
+// optionKeys returns the community.options keys given in the environment or flags.
+func optionKeys() []string {
+	var keys []string
+	seen := map[string]bool{}
+	envOptionPrefix := EnvName("community.options.")
+	for _, env := range os.Environ() {
+		name := strings.SplitN(env, "=", 2)[0]
+		if strings.HasPrefix(name, envOptionPrefix) && len(name) > len(envOptionPrefix) {
+			key := "community.options." + strings.ToLower(name[len(envOptionPrefix):])
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	for key := range overrides {
+		if strings.HasPrefix(key, "community.options.") && !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (p *Profile) clone() *Profile {
+	c := *p
+	if p.Community != nil {
+		community := *p.Community
+		community.Options = make(map[string]string, len(p.Community.Options))
+		for k, v := range p.Community.Options {
+			community.Options[k] = v
+		}
+		if p.Community.TLS != nil {
+			tls := *p.Community.TLS
+			community.TLS = &tls
+		}
+		c.Community = &community
+	}
+	if p.Cloud != nil {
+		cloud := *p.Cloud
+		c.Cloud = &cloud
+	}
+	return &c
+}
+
+// Resolve returns the active profile with flags, environment variables and
+// defaults applied, in the order flag > env > profile > default, and where
+// each effective value came from.
+func (c *Config) Resolve() (*Profile, []ResolvedValue, error) {
+	name := c.ActiveProfile()
+	p := &Profile{}
+	if stored, ok := c.Profiles[name]; ok {
+		p = stored.clone()
+	}
+	v := reflect.ValueOf(p).Elem()
+
+	for key := range overrides {
+		if _, _, err := lookup(reflect.ValueOf(&Profile{}).Elem(), key, true); err != nil {
+			return nil, nil, errors.Wrap(err, "invalid --override")
+		}
+	}
+
+	var resolved []ResolvedValue
+	keys := append(layeredKeys("", v.Type()), optionKeys()...)
+	for _, key := range keys {
+		value, err := getKey(v, key)
+		if err != nil {
+			return nil, nil, err
+		}
+		r := ResolvedValue{Key: key, Value: value, Source: SourceProfile, Origin: name}
+		if flag, ok := overrides[key]; ok {
+			r = ResolvedValue{Key: key, Value: flag, Source: SourceFlag, Origin: "--override " + key}
+		} else if env := os.Getenv(EnvName(key)); env != "" {
+			r = ResolvedValue{Key: key, Value: env, Source: SourceEnv, Origin: EnvName(key)}
+		}
+		if r.Source != SourceProfile {
+			if err := setKey(v, key, r.Value); err != nil {
+				return nil, nil, errors.Wrapf(err, "invalid %s", r.Origin)
+			}
+		}
+		if !isZeroKey(v, key) {
+			resolved = append(resolved, r)
+		}
+	}
+
+	// defaults only fill in sections that are configured
+	for _, key := range layeredKeys("", v.Type()) {
+		def, ok := defaults[key]
+		if !ok {
+			continue
+		}
+		section, _, _ := lookup(v, strings.SplitN(key, ".", 2)[0], false)
+		if !section.IsValid() || section.IsNil() {
+			continue
+		}
+		if !isZeroKey(v, key) {
+			continue
+		}
+		if err := setKey(v, key, def); err != nil {
+			return nil, nil, err
+		}
+		resolved = append(resolved, ResolvedValue{Key: key, Value: def, Source: SourceDefault})
+	}
+
+	if p.Target == "" {
+		switch {
+		case p.Community != nil:
+			p.Target = TARGET_COMMUNITY
+		case p.Cloud != nil:
+			p.Target = TARGET_CLOUD
+		}
+		if p.Target != "" {
+			resolved = append(resolved, ResolvedValue{Key: "target", Value: p.Target, Source: SourceDefault})
+		}
+	}
+
+	sort.SliceStable(resolved, func(i, j int) bool {
+		return indexOf(keys, resolved[i].Key) < indexOf(keys, resolved[j].Key)
+	})
+	return p, resolved, nil
+}
+
+func isZeroKey(v reflect.Value, key string) bool {
+	field, mapKey, err := lookup(v, key, false)
+	if err != nil || !field.IsValid() {
+		return true
+	}
+	if field.Kind() == reflect.Map {
+		return mapValue(field, mapKey) == ""
+	}
+	return field.IsZero()
+}
+
+func indexOf(values []string, value string) int {
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+	return len(values)
+}
@@ -0,0 +1,69 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvName(t *testing.T) {
+	assert.Equal(t, "BENDSQL_COMMUNITY_HOST", EnvName("community.host"))
+	assert.Equal(t, "BENDSQL_COMMUNITY_OPTIONS_MAX_ROWS", EnvName("community.options.max_rows"))
+}
+
+func TestResolve(t *testing.T) {
+	cfg := &Config{}
+	p := cfg.UpsertProfile(DefaultProfile)
+	p.Target = TARGET_COMMUNITY
+	p.Community = &CommunityConfig{Host: "profile-host", User: "profile-user", Database: "db"}
+
+	t.Setenv("BENDSQL_COMMUNITY_HOST", "env-host")
+	t.Setenv("BENDSQL_COMMUNITY_USER", "env-user")
+	t.Setenv("BENDSQL_COMMUNITY_OPTIONS_MAX_ROWS", "10")
+	SetOverrides(map[string]string{"community.host": "flag-host"})
+	t.Cleanup(func() { SetOverrides(map[string]string{}) })
+
+	effective, resolved, err := cfg.Resolve()
+	assert.NoError(t, err)
+	assert.Equal(t, "flag-host", effective.Community.Host)
+	assert.Equal(t, 8000, effective.Community.Port)
+	assert.Equal(t, "profile-host", p.Community.Host, "the stored profile is not modified")
+
+	assert.Equal(t, []ResolvedValue{
+		{Key: "target", Value: TARGET_COMMUNITY, Source: SourceProfile, Origin: DefaultProfile},
+		{Key: "community.host", Value: "flag-host", Source: SourceFlag, Origin: "--override community.host"},
+		{Key: "community.port", Value: "8000", Source: SourceDefault},
+		{Key: "community.user", Value: "env-user", Source: SourceEnv, Origin: "BENDSQL_COMMUNITY_USER"},
+		{Key: "community.database", Value: "db", Source: SourceProfile, Origin: DefaultProfile},
+		{Key: "community.options.max_rows", Value: "10", Source: SourceEnv, Origin: "BENDSQL_COMMUNITY_OPTIONS_MAX_ROWS"},
+	}, resolved)
+}
+
+func TestResolveWithoutProfile(t *testing.T) {
+	cfg := &Config{}
+	t.Setenv("BENDSQL_CLOUD_WAREHOUSE", "etl")
+
+	effective, _, err := cfg.Resolve()
+	assert.NoError(t, err)
+	assert.Equal(t, TARGET_CLOUD, effective.Target)
+	assert.Equal(t, "etl", effective.Cloud.Warehouse)
+	assert.Equal(t, "https://app.databend.com", effective.Cloud.Endpoint)
+
+	t.Setenv("BENDSQL_CLOUD_ENDPOINT", "app.databend.com")
+	_, _, err = cfg.Resolve()
+	assert.EqualError(t, err, `invalid BENDSQL_CLOUD_ENDPOINT: invalid value for cloud.endpoint: invalid url "app.databend.com", expected http(s)://host`)
+}
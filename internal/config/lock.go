@@ -0,0 +1,86 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// Update runs fn on the latest config.toml and writes the result back while
+// holding the config lock, so parallel bendsql processes don't lose each
+// other's changes. Nothing is written in ephemeral mode.
+func Update(fn func(cfg *Config) error) error {
+	_, err := update(fn)
+	return err
+}
+
+// update is Update returning the path of the backup copy saved when the file
+// was migrated from an older version.
+func update(fn func(cfg *Config) error) (string, error) {
+	if ephemeral {
+		cfg, _, err := readConfig()
+		if err != nil {
+			return "", err
+		}
+		return "", fn(cfg)
+	}
+	unlock, err := Lock()
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	cfg, version, err := readConfig()
+	if err != nil {
+		return "", err
+	}
+	if err := fn(cfg); err != nil {
+		return "", err
+	}
+	var backup string
+	if version != CurrentVersion {
+		if backup, err = backupConfig(version); err != nil {
+			return "", err
+		}
+	}
+	return backup, WriteConfig(cfg)
+}
+
+// Lock takes the advisory lock on config.toml.lock, waiting for other
+// bendsql processes to release it. The lock also guards the credential vault.
+func Lock() (unlock func(), err error) {
+	path := Path()
+	if path == "" {
+		return nil, errNoConfigPath
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, errors.Wrap(err, "create config directory")
+	}
+	f, err := os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, "open config lock file")
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, errors.Wrap(err, "lock config file")
+	}
+	return func() {
+		_ = unlockFile(f)
+		f.Close()
+	}, nil
+}
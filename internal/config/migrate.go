@@ -0,0 +1,197 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// CurrentVersion is the config.toml layout written by this version of bendsql.
+const CurrentVersion = 1
+
+// Migration upgrades a config file to Version from the version before it.
+// It works on the decoded TOML document rather than on Config, so that it
+// keeps working after Config no longer has the old keys.
+type Migration struct {
+	Version     int
+	Description string
+
+	migrate func(doc map[string]interface{}) error
+}
+
+// migrations are ordered by Version, starting at 1.
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "move target, cloud and community into the default profile",
+		migrate:     migrateProfiles,
+	},
+}
+
+func migrateProfiles(doc map[string]interface{}) error {
+	legacy := make(map[string]interface{})
+	for _, key := range []string{"target", "cloud", "community"} {
+		if v, ok := doc[key]; ok {
+			legacy[key] = v
+			delete(doc, key)
+		}
+	}
+	if len(legacy) == 0 {
+		return nil
+	}
+	if _, ok := doc["profiles"]; !ok {
+		doc["profiles"] = make(map[string]interface{})
+	}
+	profiles, ok := doc["profiles"].(map[string]interface{})
+	if !ok {
+		return errors.New("profiles is not a table")
+	}
+	if _, ok := profiles[DefaultProfile]; !ok {
+		profiles[DefaultProfile] = legacy
+	}
+	if _, ok := doc["current_profile"]; !ok {
+		doc["current_profile"] = DefaultProfile
+	}
+	return nil
+}
+
+// decodeConfig decodes content of any supported version, version is the one
+// of content and applied the migrations run to bring it to CurrentVersion.
+func decodeConfig(content []byte) (cfg *Config, version int, applied []Migration, err error) {
+	doc := make(map[string]interface{})
+	if _, err := toml.Decode(string(content), &doc); err != nil {
+		return nil, 0, nil, errors.Wrap(err, "unmarshal config file")
+	}
+	if v, ok := doc["version"]; ok {
+		n, ok := v.(int64)
+		if !ok || n < 0 {
+			return nil, 0, nil, errors.Errorf("invalid version %v", v)
+		}
+		version = int(n)
+	}
+	if version > CurrentVersion {
+		return nil, 0, nil, errors.Errorf("version %d is newer than %d supported by this bendsql, please upgrade bendsql", version, CurrentVersion)
+	}
+	for _, m := range migrations {
+		if m.Version <= version {
+			continue
+		}
+		if err := m.migrate(doc); err != nil {
+			return nil, 0, nil, errors.Wrapf(err, "migrate to version %d", m.Version)
+		}
+		applied = append(applied, m)
+	}
+	if len(applied) > 0 {
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(doc); err != nil {
+			return nil, 0, nil, errors.Wrap(err, "encode migrated config")
+		}
+		content = buf.Bytes()
+	}
+
+	cfg = &Config{}
+	md, err := toml.Decode(string(content), cfg)
+	if err != nil {
+		return nil, 0, nil, errors.Wrap(err, "unmarshal config file")
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		return nil, 0, nil, errors.Errorf("unknown key %s", undecoded[0])
+	}
+	cfg.Version = CurrentVersion
+	return cfg, version, applied, nil
+}
+
+// BackupPath is where config.toml of version is copied before it is migrated.
+func BackupPath(version int) string {
+	return fmt.Sprintf("%s.v%d.bak", Path(), version)
+}
+
+func backupConfig(version int) (string, error) {
+	content, err := os.ReadFile(Path())
+	if err != nil {
+		return "", errors.Wrap(err, "read config file")
+	}
+	backup := BackupPath(version)
+	if err := writeFileAtomic(backup, content); err != nil {
+		return "", errors.Wrap(err, "write config backup")
+	}
+	return backup, nil
+}
+
+// MigrationPlan shows how config.toml is changed by Migrate.
+type MigrationPlan struct {
+	Path       string
+	Version    int
+	Migrations []Migration
+	Before     []byte
+	After      []byte
+}
+
+// PlanMigration migrates config.toml in memory, Migrations is empty when
+// the file is missing or already at CurrentVersion.
+func PlanMigration() (*MigrationPlan, error) {
+	plan := &MigrationPlan{Path: Path(), Version: CurrentVersion}
+	if plan.Path == "" || !exists(plan.Path) {
+		return plan, nil
+	}
+	content, err := os.ReadFile(plan.Path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read config file")
+	}
+	cfg, version, applied, err := decodeConfig(content)
+	if err != nil {
+		return nil, errors.Wrapf(err, "config file %s", plan.Path)
+	}
+	plan.Version = version
+	plan.Migrations = applied
+	plan.Before = content
+	if version != CurrentVersion {
+		if plan.After, err = encodeConfig(cfg); err != nil {
+			return nil, err
+		}
+	} else {
+		plan.After = content
+	}
+	return plan, nil
+}
+
+// Diff returns the changes of the plan as a unified diff.
+func (p *MigrationPlan) Diff() (string, error) {
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(p.Before)),
+		B:        difflib.SplitLines(string(p.After)),
+		FromFile: fmt.Sprintf("%s (version %d)", p.Path, p.Version),
+		ToFile:   fmt.Sprintf("%s (version %d)", p.Path, CurrentVersion),
+		Context:  3,
+	})
+}
+
+// Migrate upgrades config.toml to CurrentVersion, keeping a copy of the old
+// file. It returns the path of the copy, empty when there was nothing to do.
+func Migrate() (string, error) {
+	if ephemeral {
+		return "", errors.New("can not migrate the config file with --ephemeral")
+	}
+	if path := Path(); path == "" || !exists(path) {
+		return "", nil
+	}
+	return update(func(*Config) error { return nil })
+}
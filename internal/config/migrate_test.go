@@ -0,0 +1,79 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const legacyConfig = `
+target = "community"
+
+[community]
+host = "localhost"
+port = 8000
+user = "root"
+`
+
+func TestDecodeLegacyConfig(t *testing.T) {
+	cfg, version, applied, err := decodeConfig([]byte(legacyConfig))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, version)
+	assert.Len(t, applied, 1)
+
+	assert.Equal(t, CurrentVersion, cfg.Version)
+	assert.Equal(t, DefaultProfile, cfg.CurrentProfile)
+	p, err := cfg.Profile(DefaultProfile)
+	assert.NoError(t, err)
+	assert.Equal(t, TARGET_COMMUNITY, p.Target)
+	assert.Equal(t, "localhost", p.Community.Host)
+
+	_, _, _, err = decodeConfig([]byte("version = 99\n"))
+	assert.EqualError(t, err, "version 99 is newer than 1 supported by this bendsql, please upgrade bendsql")
+}
+
+func TestMigrate(t *testing.T) {
+	useTempConfig(t)
+	assert.NoError(t, os.WriteFile(configFile, []byte(legacyConfig), 0600))
+
+	plan, err := PlanMigration()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, plan.Version)
+	assert.Len(t, plan.Migrations, 1)
+	diff, err := plan.Diff()
+	assert.NoError(t, err)
+	assert.Contains(t, diff, "-target = \"community\"")
+	assert.Contains(t, diff, "+  [profiles.default]")
+
+	// planning must not change the file
+	content, err := os.ReadFile(configFile)
+	assert.NoError(t, err)
+	assert.Equal(t, legacyConfig, string(content))
+
+	cfg, err := GetConfig()
+	assert.NoError(t, err)
+	assert.Contains(t, cfg.Profiles, DefaultProfile)
+
+	backup, err := os.ReadFile(BackupPath(0))
+	assert.NoError(t, err)
+	assert.Equal(t, legacyConfig, string(backup))
+	plan, err = PlanMigration()
+	assert.NoError(t, err)
+	assert.Equal(t, CurrentVersion, plan.Version)
+	assert.Empty(t, plan.Migrations)
+}
@@ -0,0 +1,472 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const secretMask = "********"
+
+// keyRule constrains the values of a config key beyond its Go type.
+type keyRule struct {
+	Allowed  []string
+	Secret   bool
+	Validate func(value string) error
+}
+
+// globalKeys are keys of Config itself, all other keys belong to a profile.
+var globalKeys = map[string]bool{
+	"current_profile":   true,
+	"credential_store":  true,
+	"retry.attempts":    true,
+	"retry.delay":       true,
+	"retry.max_delay":   true,
+	"retry.max_elapsed": true,
+}
+
+var keyRules = map[string]keyRule{
+	"credential_store":          {Allowed: []string{CredentialStoreVault, CredentialStorePlaintext}},
+	"target":                    {Allowed: []string{TARGET_COMMUNITY, TARGET_CLOUD}},
+	"community.port":            {Validate: validatePort},
+	"community.password":        {Secret: true},
+	"community.tls.verify":      {Allowed: []string{TLSVerifyFull, TLSVerifyCA, TLSVerifyNone}},
+	"cloud.endpoint":            {Validate: validateURL},
+	"retry.attempts":            {Validate: validateAttempts},
+	"retry.delay":               {Validate: validateDuration},
+	"retry.max_delay":           {Validate: validateDuration},
+	"retry.max_elapsed":         {Validate: validateDuration},
+	"cloud.token.access_token":  {Secret: true},
+	"cloud.token.refresh_token": {Secret: true},
+}
+
+// KeyValue is a config key with its value as shown by `bendsql config list`.
+type KeyValue struct {
+	Key   string
+	Value string
+}
+
+func validatePort(value string) error {
+	port, err := strconv.Atoi(value)
+	if err != nil || port <= 0 || port > 65535 {
+		return errors.Errorf("invalid port %q", value)
+	}
+	return nil
+}
+
+func validateAttempts(value string) error {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return errors.Errorf("invalid attempts %q, expected a positive integer", value)
+	}
+	return nil
+}
+
+func validateDuration(value string) error {
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return errors.Errorf("invalid duration %q, expected e.g. 500ms or 2m", value)
+	}
+	return nil
+}
+
+func validateURL(value string) error {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.Errorf("invalid url %q, expected http(s)://host", value)
+	}
+	return nil
+}
+
+// isSecretKey reports whether values of key should be masked.
+func isSecretKey(key string) bool {
+	if keyRules[key].Secret {
+		return true
+	}
+	if strings.Contains(key, ".options.") {
+		name := strings.ToLower(key[strings.LastIndex(key, ".")+1:])
+		return strings.Contains(name, "password") || strings.Contains(name, "token") || strings.Contains(name, "secret")
+	}
+	return false
+}
+
+// MaskSecret hides literal secrets of key, references are shown as they are.
+func MaskSecret(key, value string) string {
+	if value == "" || !isSecretKey(key) || IsSecretRef(value) {
+		return value
+	}
+	return secretMask
+}
+
+// RedactDSN masks the password and secret query parameters of dsn.
+func RedactDSN(dsn string) string {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return dsn
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), secretMask)
+	}
+	query := u.Query()
+	for k := range query {
+		if k == "access_token" || isSecretKey("community.options."+k) {
+			query.Set(k, secretMask)
+		}
+	}
+	u.RawQuery = query.Encode()
+	// the mask is escaped by url, it is only for display
+	return strings.ReplaceAll(u.String(), url.QueryEscape(secretMask), secretMask)
+}
+
+// root returns the struct a key is looked up in, profile keys use the active profile.
+func (c *Config) root(key string, create bool) (reflect.Value, error) {
+	if globalKeys[key] {
+		return reflect.ValueOf(c).Elem(), nil
+	}
+	name := c.ActiveProfile()
+	if create {
+		return reflect.ValueOf(c.UpsertProfile(name)).Elem(), nil
+	}
+	p, err := c.Profile(name)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	return reflect.ValueOf(p).Elem(), nil
+}
+
+// lookup walks the dotted key through v, a struct, by toml tag names. When the
+// key ends in a map entry, the map and the entry name are returned.
+func lookup(v reflect.Value, key string, create bool) (field reflect.Value, mapKey string, err error) {
+	parts := strings.Split(key, ".")
+	for i, part := range parts {
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !create {
+					return reflect.Value{}, "", nil
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		// only maps of strings hold values, others are tables such as cloud.accounts
+		if v.Kind() == reflect.Map && i == len(parts)-1 && v.Type().Elem().Kind() == reflect.String {
+			if v.IsNil() && create {
+				v.Set(reflect.MakeMap(v.Type()))
+			}
+			return v, part, nil
+		}
+		if v.Kind() != reflect.Struct || v.Type() == reflect.TypeOf(time.Time{}) {
+			return reflect.Value{}, "", errors.Errorf("unknown key %s", key)
+		}
+		f, ok := fieldByTag(v, part)
+		if !ok {
+			return reflect.Value{}, "", errors.Errorf("unknown key %s", key)
+		}
+		v = f
+	}
+	if v.Kind() == reflect.Map {
+		return reflect.Value{}, "", errors.Errorf("key %s is a table, use %s.NAME", key, key)
+	}
+	return v, "", nil
+}
+
+func fieldByTag(v reflect.Value, name string) (reflect.Value, bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("toml"), ",")[0]
+		if tag == name && tag != "" && tag != "-" {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func formatValue(v reflect.Value) string {
+	if t, ok := v.Interface().(time.Time); ok {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format(time.RFC3339)
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Int, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	}
+	return ""
+}
+
+func parseValue(v reflect.Value, key, value string) (reflect.Value, error) {
+	rule := keyRules[key]
+	if len(rule.Allowed) > 0 && !contains(rule.Allowed, value) {
+		return reflect.Value{}, errors.Errorf("invalid value %q for %s, valid values are {%s}", value, key, strings.Join(rule.Allowed, "|"))
+	}
+	if rule.Validate != nil {
+		if err := rule.Validate(value); err != nil {
+			return reflect.Value{}, errors.Wrapf(err, "invalid value for %s", key)
+		}
+	}
+	if v.Type() == reflect.TypeOf(time.Time{}) {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return reflect.Value{}, errors.Errorf("invalid value %q for %s, expected RFC 3339 time", value, key)
+		}
+		return reflect.ValueOf(t), nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return reflect.ValueOf(value).Convert(v.Type()), nil
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return reflect.Value{}, errors.Errorf("invalid value %q for %s, expected an integer", value, key)
+		}
+		return reflect.ValueOf(n).Convert(v.Type()), nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return reflect.Value{}, errors.Errorf("invalid value %q for %s, expected true or false", value, key)
+		}
+		return reflect.ValueOf(b), nil
+	}
+	return reflect.Value{}, errors.Errorf("key %s is a table, use one of its keys", key)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// GetValue returns the value of a dotted key such as community.host or
+// community.options.max_rows in the active profile.
+func (c *Config) GetValue(key string) (string, error) {
+	v, err := c.root(key, false)
+	if err != nil {
+		return "", err
+	}
+	return getKey(v, key)
+}
+
+func getKey(v reflect.Value, key string) (string, error) {
+	field, mapKey, err := lookup(v, key, false)
+	if err != nil || !field.IsValid() {
+		return "", err
+	}
+	if field.Kind() == reflect.Map {
+		return mapValue(field, mapKey), nil
+	}
+	return formatValue(field), nil
+}
+
+func mapValue(m reflect.Value, key string) string {
+	if m.IsNil() {
+		return ""
+	}
+	v := m.MapIndex(reflect.ValueOf(key))
+	if !v.IsValid() {
+		return ""
+	}
+	return v.String()
+}
+
+// SetValue validates and sets a dotted key in the active profile. Secrets
+// are saved to the credential store.
+func (c *Config) SetValue(key, value string) error {
+	v, err := c.root(key, true)
+	if err != nil {
+		return err
+	}
+	if _, _, err := lookup(v, key, false); err != nil {
+		return err
+	}
+	if isSecretKey(key) {
+		secretKey := key
+		if !globalKeys[key] {
+			secretKey = "profiles." + c.ActiveProfile() + "." + key
+		}
+		if value, err = c.SealSecret(secretKey, value); err != nil {
+			return err
+		}
+	}
+	return setKey(v, key, value)
+}
+
+// SetSecretRef sets a secret key of the active profile to a reference given
+// as env:NAME, file:PATH or cmd:COMMAND, resolved on each connection.
+func (c *Config) SetSecretRef(key, ref string) error {
+	if !isSecretKey(key) {
+		return errors.Errorf("%s is not a secret, only secrets can be set to a reference", key)
+	}
+	value, err := SecretRef(ref)
+	if err != nil {
+		return err
+	}
+	v, err := c.root(key, true)
+	if err != nil {
+		return err
+	}
+	return setKey(v, key, value)
+}
+
+// setKey parses value and stores it under the dotted key of v.
+func setKey(v reflect.Value, key, value string) error {
+	field, mapKey, err := lookup(v, key, true)
+	if err != nil {
+		return err
+	}
+	if field.Kind() == reflect.Map {
+		field.SetMapIndex(reflect.ValueOf(mapKey), reflect.ValueOf(value))
+		return nil
+	}
+	parsed, err := parseValue(field, key, value)
+	if err != nil {
+		return err
+	}
+	field.Set(parsed)
+	return nil
+}
+
+// UnsetValue resets a dotted key of the active profile, unsetting a table
+// such as cloud.token removes the whole table.
+func (c *Config) UnsetValue(key string) error {
+	v, err := c.root(key, false)
+	if err != nil {
+		return err
+	}
+	field, mapKey, err := lookup(v, key, false)
+	if err != nil || !field.IsValid() {
+		return err
+	}
+	if field.Kind() == reflect.Map {
+		if !field.IsNil() {
+			field.SetMapIndex(reflect.ValueOf(mapKey), reflect.Value{})
+		}
+		return nil
+	}
+	field.Set(reflect.Zero(field.Type()))
+	return nil
+}
+
+// List returns the global keys and the keys set in the active profile,
+// literal secrets are masked.
+func (c *Config) List() []KeyValue {
+	var kvs []KeyValue
+	global := make([]string, 0, len(globalKeys))
+	for key := range globalKeys {
+		global = append(global, key)
+	}
+	sort.Strings(global)
+	for _, key := range global {
+		if value, _ := c.GetValue(key); value != "" {
+			kvs = append(kvs, KeyValue{Key: key, Value: value})
+		}
+	}
+	if p, err := c.Profile(c.ActiveProfile()); err == nil {
+		kvs = flatten(kvs, "", reflect.ValueOf(p).Elem())
+	}
+	return kvs
+}
+
+func flatten(kvs []KeyValue, prefix string, v reflect.Value) []KeyValue {
+	walk(prefix, prefix, v, func(key, rule, value string) {
+		kvs = append(kvs, KeyValue{Key: key, Value: MaskSecret(rule, value)})
+	})
+	return kvs
+}
+
+// walk calls fn for every key set in v. rule is the key the rules of key are
+// looked up by, they differ for the entries of struct-valued maps, e.g. the
+// rules of cloud.accounts.NAME.token.access_token are those of
+// cloud.token.access_token.
+func walk(prefix, rulePrefix string, v reflect.Value, fn func(key, rule, value string)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("toml"), ",")[0]
+		if tag == "" || tag == "-" {
+			continue
+		}
+		key, rule := prefix+tag, rulePrefix+tag
+		f := v.Field(i)
+		switch {
+		case f.Kind() == reflect.Ptr:
+			if !f.IsNil() {
+				walk(key+".", rule+".", f.Elem(), fn)
+			}
+		case f.Kind() == reflect.Map:
+			names := make([]string, 0, f.Len())
+			for _, k := range f.MapKeys() {
+				names = append(names, k.String())
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				entry := f.MapIndex(reflect.ValueOf(name))
+				if entry.Kind() == reflect.Ptr {
+					if !entry.IsNil() {
+						walk(key+"."+name+".", rulePrefix, entry.Elem(), fn)
+					}
+					continue
+				}
+				fn(key+"."+name, rule+"."+name, entry.String())
+			}
+		case !f.IsZero():
+			fn(key, rule, formatValue(f))
+		}
+	}
+}
+
+// Validate checks every profile against the key rules.
+func (c *Config) Validate() error {
+	if c.CredentialStore != "" {
+		if _, err := parseValue(reflect.ValueOf(c.CredentialStore), "credential_store", c.CredentialStore); err != nil {
+			return err
+		}
+	}
+	if c.Retry != nil {
+		for _, kv := range flatten(nil, "retry.", reflect.ValueOf(c.Retry).Elem()) {
+			if _, err := parseValue(reflect.ValueOf(kv.Value), kv.Key, kv.Value); err != nil {
+				return err
+			}
+		}
+	}
+	for _, name := range c.ProfileNames() {
+		var err error
+		walk("", "", reflect.ValueOf(c.Profiles[name]).Elem(), func(key, rule, value string) {
+			if err != nil || len(keyRules[rule].Allowed) == 0 && keyRules[rule].Validate == nil {
+				return
+			}
+			if _, err = parseValue(reflect.ValueOf(value), rule, value); err != nil && key != rule {
+				err = errors.Wrap(err, key)
+			}
+		})
+		if err != nil {
+			return errors.Wrapf(err, "profile %s", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"os"
+	"sync"
+
+	dc "github.com/databendcloud/databend-go"
+	"github.com/pkg/errors"
+)
+
+// Verify modes of TLSConfig.
+const (
+	TLSVerifyFull = "full"
+	TLSVerifyCA   = "ca"
+	TLSVerifyNone = "none"
+)
+
+// TLSConfig is how a community connection verifies the server and
+// authenticates with a client certificate, stored as
+// [profiles.NAME.community.tls].
+type TLSConfig struct {
+	// CACert is a PEM file of the CAs trusted besides the system ones.
+	CACert     string `toml:"ca_cert,omitempty"`
+	ClientCert string `toml:"client_cert,omitempty"`
+	ClientKey  string `toml:"client_key,omitempty"`
+	// ServerName is verified instead of the host connected to.
+	ServerName string `toml:"server_name,omitempty"`
+	// Verify is full, the default, ca to skip the host name check or none.
+	Verify string `toml:"verify,omitempty"`
+}
+
+// Build loads the certificates and returns the tls.Config to connect with.
+func (t *TLSConfig) Build() (*tls.Config, error) {
+	cfg := &tls.Config{ServerName: t.ServerName}
+	if t.CACert != "" {
+		pem, err := os.ReadFile(t.CACert)
+		if err != nil {
+			return nil, errors.Wrap(err, "read ca_cert")
+		}
+		cfg.RootCAs, err = x509.SystemCertPool()
+		if err != nil {
+			cfg.RootCAs = x509.NewCertPool()
+		}
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("no certificates found in ca_cert %s", t.CACert)
+		}
+	}
+	if t.ClientCert != "" || t.ClientKey != "" {
+		if t.ClientCert == "" || t.ClientKey == "" {
+			return nil, errors.New("client_cert and client_key must be given together")
+		}
+		cert, err := tls.LoadX509KeyPair(t.ClientCert, t.ClientKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "load client certificate")
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	switch t.Verify {
+	case "", TLSVerifyFull:
+	case TLSVerifyCA:
+		// the chain is verified below, only the host name check is skipped
+		cfg.InsecureSkipVerify = true
+		roots := cfg.RootCAs
+		cfg.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return verifyChain(rawCerts, roots)
+		}
+	case TLSVerifyNone:
+		cfg.InsecureSkipVerify = true
+	default:
+		return nil, errors.Errorf("invalid verify %q, valid values are {full|ca|none}", t.Verify)
+	}
+	return cfg, nil
+}
+
+func verifyChain(rawCerts [][]byte, roots *x509.CertPool) error {
+	if len(rawCerts) == 0 {
+		return errors.New("no server certificate")
+	}
+	intermediates := x509.NewCertPool()
+	var leaf *x509.Certificate
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return errors.Wrap(err, "parse server certificate")
+		}
+		if i == 0 {
+			leaf = cert
+		} else {
+			intermediates.AddCert(cert)
+		}
+	}
+	_, err := leaf.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+	return err
+}
+
+var (
+	tlsTransportOnce sync.Once
+	tlsTransport     = &hostTLSTransport{hosts: map[string]http.RoundTripper{}}
+)
+
+// registerTLS makes connections to host use cfg and returns the tls_config
+// name to put in the DSN. databend-go registers it for the driver, but its
+// REST client sends queries through http.DefaultTransport, so that is
+// wrapped to pick cfg for host as well.
+func registerTLS(host string, cfg *tls.Config) (string, error) {
+	name := "bendsql-" + host
+	if err := dc.RegisterTLSConfig(name, cfg); err != nil {
+		return "", errors.Wrap(err, "register tls config")
+	}
+	tlsTransportOnce.Do(func() {
+		tlsTransport.base = http.DefaultTransport
+		http.DefaultTransport = tlsTransport
+	})
+	tlsTransport.set(host, cfg)
+	return name, nil
+}
+
+// hostTLSTransport sends requests to registered hosts with their own TLS
+// config and all others through base.
+type hostTLSTransport struct {
+	base http.RoundTripper
+
+	mu    sync.RWMutex
+	hosts map[string]http.RoundTripper
+}
+
+func (t *hostTLSTransport) set(host string, cfg *tls.Config) {
+	transport := &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: cfg}
+	if base, ok := t.base.(*http.Transport); ok {
+		transport = base.Clone()
+		transport.TLSClientConfig = cfg
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if old, ok := t.hosts[host].(*http.Transport); ok {
+		old.CloseIdleConnections()
+	}
+	t.hosts[host] = transport
+}
+
+func (t *hostTLSTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.RLock()
+	transport, ok := t.hosts[req.URL.Host]
+	t.mu.RUnlock()
+	if !ok || req.URL.Scheme != "https" {
+		transport = t.base
+	}
+	return transport.RoundTrip(req)
+}
@@ -0,0 +1,66 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommunityTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	caCert := filepath.Join(t.TempDir(), "ca.pem")
+	assert.NoError(t, os.WriteFile(caCert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0600))
+	host, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	portNum, _ := strconv.Atoi(port)
+
+	c := &CommunityConfig{Host: host, Port: portNum, SSL: true, TLS: &TLSConfig{CACert: caCert}}
+	dsn, err := c.GetDSN(RuntimeOptions{})
+	assert.NoError(t, err)
+	assert.Contains(t, dsn, "tls_config=bendsql-"+host)
+	// queries go through the default transport
+	resp, err := http.Get(srv.URL)
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+	}
+
+	dial := func(tc *TLSConfig) error {
+		cfg, err := tc.Build()
+		if err != nil {
+			return err
+		}
+		conn, err := tls.Dial("tcp", srv.Listener.Addr().String(), cfg)
+		if err == nil {
+			conn.Close()
+		}
+		return err
+	}
+	assert.Error(t, dial(&TLSConfig{CACert: caCert, ServerName: "db.internal"}))
+	assert.NoError(t, dial(&TLSConfig{CACert: caCert, ServerName: "db.internal", Verify: TLSVerifyCA}))
+	assert.Error(t, dial(&TLSConfig{Verify: TLSVerifyCA}))
+	assert.NoError(t, dial(&TLSConfig{Verify: TLSVerifyNone}))
+	assert.EqualError(t, dial(&TLSConfig{Verify: "some"}), `invalid verify "some", valid values are {full|ca|none}`)
+	assert.EqualError(t, dial(&TLSConfig{ClientCert: caCert}), "client_cert and client_key must be given together")
+}
@@ -0,0 +1,261 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	vaultVersion    = 1
+	vaultIterations = 600000
+	vaultKeyLen     = 32
+)
+
+var passphraseFunc func(create bool) (string, error)
+
+// SetPassphraseFunc sets how the vault passphrase is asked for when
+// BENDSQL_VAULT_PASSPHRASE is not set, create is true for a new vault.
+func SetPassphraseFunc(fn func(create bool) (string, error)) {
+	passphraseFunc = fn
+}
+
+// vaultFile is the on-disk layout of the vault, Data is the AES-GCM sealed
+// JSON object of all secrets.
+type vaultFile struct {
+	Version    int    `json:"version"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Data       []byte `json:"data"`
+}
+
+// vault is a passphrase-encrypted CredentialStore stored next to config.toml.
+type vault struct {
+	path       string
+	salt       []byte
+	iterations int
+	key        []byte
+	entries    map[string]string
+}
+
+func vaultPath() string {
+	return filepath.Join(filepath.Dir(Path()), "credentials.vault")
+}
+
+func vaultPassphrase(create bool) (string, error) {
+	if a := os.Getenv("BENDSQL_VAULT_PASSPHRASE"); a != "" {
+		return a, nil
+	}
+	if passphraseFunc == nil {
+		return "", errors.New("please set BENDSQL_VAULT_PASSPHRASE to unlock the credential vault")
+	}
+	return passphraseFunc(create)
+}
+
+func openVault() (CredentialStore, error) {
+	v := &vault{
+		path:    vaultPath(),
+		entries: make(map[string]string),
+	}
+	content, err := os.ReadFile(v.path)
+	if os.IsNotExist(err) {
+		passphrase, err := vaultPassphrase(true)
+		if err != nil {
+			return nil, err
+		}
+		v.salt = make([]byte, 16)
+		if _, err := rand.Read(v.salt); err != nil {
+			return nil, errors.Wrap(err, "generate salt")
+		}
+		v.iterations = vaultIterations
+		v.key = pbkdf2SHA256([]byte(passphrase), v.salt, v.iterations, vaultKeyLen)
+		return v, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "read vault file")
+	}
+
+	f, err := decodeVaultFile(content)
+	if err != nil {
+		return nil, err
+	}
+	passphrase, err := vaultPassphrase(false)
+	if err != nil {
+		return nil, err
+	}
+	v.salt = f.Salt
+	v.iterations = f.Iterations
+	v.key = pbkdf2SHA256([]byte(passphrase), v.salt, v.iterations, vaultKeyLen)
+	if err := v.decrypt(f); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func decodeVaultFile(content []byte) (*vaultFile, error) {
+	var f vaultFile
+	if err := json.Unmarshal(content, &f); err != nil {
+		return nil, errors.Wrap(err, "unmarshal vault file")
+	}
+	if f.Version != vaultVersion {
+		return nil, errors.Errorf("unsupported vault version %d", f.Version)
+	}
+	return &f, nil
+}
+
+func (v *vault) decrypt(f *vaultFile) error {
+	gcm, err := v.cipher()
+	if err != nil {
+		return err
+	}
+	plain, err := gcm.Open(nil, f.Nonce, f.Data, nil)
+	if err != nil {
+		return errors.New("wrong vault passphrase")
+	}
+	entries := make(map[string]string)
+	if err := json.Unmarshal(plain, &entries); err != nil {
+		return errors.Wrap(err, "unmarshal vault entries")
+	}
+	v.entries = entries
+	return nil
+}
+
+// reload reads the entries again, another bendsql process may have saved
+// the vault since it was opened.
+func (v *vault) reload() error {
+	content, err := os.ReadFile(v.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "read vault file")
+	}
+	f, err := decodeVaultFile(content)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(f.Salt, v.salt) || f.Iterations != v.iterations {
+		return errors.Errorf("vault file %s was replaced by another process, please retry", v.path)
+	}
+	return v.decrypt(f)
+}
+
+func (v *vault) Get(key string) (string, error) {
+	if err := v.reload(); err != nil {
+		return "", err
+	}
+	value, ok := v.entries[key]
+	if !ok {
+		return "", errors.Errorf("secret %s not found in %s", key, v.path)
+	}
+	return value, nil
+}
+
+func (v *vault) Set(key, value string) error {
+	if err := v.reload(); err != nil {
+		return err
+	}
+	v.entries[key] = value
+	return v.save()
+}
+
+func (v *vault) Delete(key string) error {
+	if err := v.reload(); err != nil {
+		return err
+	}
+	if _, ok := v.entries[key]; !ok {
+		return nil
+	}
+	delete(v.entries, key)
+	return v.save()
+}
+
+func (v *vault) cipher() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(v.key)
+	if err != nil {
+		return nil, errors.Wrap(err, "create vault cipher")
+	}
+	return cipher.NewGCM(block)
+}
+
+func (v *vault) save() error {
+	plain, err := json.Marshal(v.entries)
+	if err != nil {
+		return errors.Wrap(err, "marshal vault entries")
+	}
+	gcm, err := v.cipher()
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return errors.Wrap(err, "generate nonce")
+	}
+	content, err := json.Marshal(vaultFile{
+		Version:    vaultVersion,
+		Iterations: v.iterations,
+		Salt:       v.salt,
+		Nonce:      nonce,
+		Data:       gcm.Seal(nil, nonce, plain, nil),
+	})
+	if err != nil {
+		return errors.Wrap(err, "marshal vault file")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(v.path), 0755); err != nil {
+		return errors.Wrap(err, "create vault directory")
+	}
+	return errors.Wrap(writeFileAtomic(v.path, content), "write vault file")
+}
+
+// pbkdf2SHA256 derives a key from password as specified in RFC 8018.
+func pbkdf2SHA256(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	hashLen := prf.Size()
+	numBlocks := (keyLen + hashLen - 1) / hashLen
+
+	var buf [4]byte
+	dk := make([]byte, 0, numBlocks*hashLen)
+	u := make([]byte, hashLen)
+	for block := 1; block <= numBlocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(buf[:], uint32(block))
+		prf.Write(buf[:])
+		dk = prf.Sum(dk)
+		t := dk[len(dk)-hashLen:]
+		copy(u, t)
+
+		for n := 2; n <= iterations; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for i := range u {
+				t[i] ^= u[i]
+			}
+		}
+	}
+	return dk[:keyLen]
+}
@@ -16,9 +16,9 @@ package benchmark
 
 import (
 	"context"
-	"database/sql/driver"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -31,6 +31,7 @@ import (
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v2"
 
+	"github.com/databendcloud/bendsql/api"
 	"github.com/databendcloud/bendsql/internal/config"
 	"github.com/databendcloud/bendsql/pkg/cmdutil"
 )
@@ -63,19 +64,24 @@ func NewCmdBenchmark(f *cmdutil.Factory) *cobra.Command {
 			"IsCore": "true",
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			cfg, err := config.GetConfig()
+			cfg, err := f.Config()
 			if err != nil {
 				return errors.Wrap(err, "failed to get config")
 			}
-			dsn, err := cfg.GetDSN(opts.ConnOpts)
+			dcConfig, err := benchmarkConfig(cfg, opts)
 			if err != nil {
-				return errors.Wrap(err, "failed to get dsn")
-			}
-			dcConfig, err := dc.ParseDSN(dsn)
-			if err != nil {
-				return errors.Wrap(err, "failed to parse dsn")
+				return err
 			}
 			cli := dc.NewAPIClientFromConfig(dcConfig)
+			// pick up renewed cloud tokens between queries of a long run
+			refresh := func() error {
+				dcConfig, err := benchmarkConfig(cfg, opts)
+				if err != nil {
+					return err
+				}
+				cli.AccessToken = dcConfig.AccessToken
+				return nil
+			}
 
 			fmt.Printf("Running benchmark with options: %+v\n", opts)
 			targets, err := ReadTargetFiles(opts.TestDir)
@@ -83,7 +89,7 @@ func NewCmdBenchmark(f *cmdutil.Factory) *cobra.Command {
 				return errors.Wrap(err, "ReadTargetFiles")
 			}
 			for _, target := range targets {
-				err := runTarget(target, cli, opts)
+				err := runTarget(cmd.Context(), target, cli, refresh, opts)
 				if err != nil {
 					return err
 				}
@@ -107,41 +113,51 @@ func NewCmdBenchmark(f *cmdutil.Factory) *cobra.Command {
 	return cmd
 }
 
-func runQuery(ctx context.Context, cli *dc.APIClient, query string) (*dc.QueryStats, error) {
-	r0, err := cli.DoQuery(ctx, query, []driver.Value{})
+func benchmarkConfig(cfg *config.Config, opts *benchmarkOptions) (*dc.Config, error) {
+	dsn, err := cfg.GetDSN(opts.ConnOpts)
 	if err != nil {
-		return nil, errors.Wrap(err, "DoQuery")
+		return nil, errors.Wrap(err, "failed to get dsn")
 	}
-	if r0.Error != nil {
-		return nil, fmt.Errorf("query has error: %s", r0.Error)
+	dcConfig, err := dc.ParseDSN(dsn)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse dsn")
 	}
-	s := r0.Stats
-	nextURI := r0.NextURI
-	for nextURI != "" {
-		p, err := cli.QueryPage(nextURI)
-		if err != nil {
-			return nil, errors.Wrap(err, "QueryPage")
-		}
-		if p.Error != nil {
-			return nil, fmt.Errorf("query page has error: %s", p.Error)
+	return dcConfig, nil
+}
+
+// runQuery runs query until its last page, a query cancelled by ctx is
+// stopped on the server.
+func runQuery(ctx context.Context, cli *dc.APIClient, refresh func() error, query string) (*dc.QueryStats, error) {
+	if err := refresh(); err != nil {
+		return nil, err
+	}
+	pages, err := api.DriverQuery(ctx, cli, query)
+	if err != nil {
+		return nil, err
+	}
+	defer pages.Close()
+	var s dc.QueryStats
+	for {
+		p, err := pages.Next(ctx)
+		if err == io.EOF {
+			return &s, nil
+		} else if err != nil {
+			return nil, err
 		}
-		nextURI = p.NextURI
 		if p.Stats.RunningTimeMS > 0 {
 			s = p.Stats
 		}
 	}
-	return &s, nil
 }
 
-func runTarget(target *InputQueryFile, cli *dc.APIClient, opts *benchmarkOptions) error {
-	ctx := context.Background()
-
+func runTarget(ctx context.Context, target *InputQueryFile, cli *dc.APIClient, refresh func() error, opts *benchmarkOptions) error {
 	output := &OutputFile{}
 	output.MetaData.Tag = opts.Tag
 	output.MetaData.Size = opts.Size
 	output.MetaData.Table = target.MetaData.Table
 	output.Schema = make([]OutputSchema, 0)
 
+	var cancelled *api.QueryCancelledError
 	for _, i := range target.Statements {
 		fmt.Printf("\nstart to run query %s : %s\n", i.Name, i.Query)
 
@@ -152,7 +168,9 @@ func runTarget(target *InputQueryFile, cli *dc.APIClient, opts *benchmarkOptions
 		o.SQL = i.Query
 
 		for j := 0; j < opts.WarmCount; j++ {
-			_, _ = runQuery(ctx, cli, i.Query)
+			if _, err := runQuery(ctx, cli, refresh, i.Query); errors.As(err, &cancelled) {
+				return err
+			}
 		}
 		fmt.Printf("%s finished warm up %d times\n", i.Name, opts.WarmCount)
 
@@ -160,7 +178,9 @@ func runTarget(target *InputQueryFile, cli *dc.APIClient, opts *benchmarkOptions
 		for j := 0; j < opts.TestCount; j++ {
 			fmt.Printf("%s[%d] running...\n", i.Name, j)
 
-			if s, err := runQuery(ctx, cli, i.Query); err != nil {
+			if s, err := runQuery(ctx, cli, refresh, i.Query); errors.As(err, &cancelled) {
+				return err
+			} else if err != nil {
 				fmt.Printf("%s[%d] result has error: %s\n", i.Name, j, err.Error())
 				o.Error = append(o.Error, err.Error())
 			} else {
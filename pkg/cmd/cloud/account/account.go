@@ -0,0 +1,38 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package account
+
+import (
+	"github.com/spf13/cobra"
+
+	accountListCmd "github.com/databendcloud/bendsql/pkg/cmd/cloud/account/ls"
+	accountSwitchCmd "github.com/databendcloud/bendsql/pkg/cmd/cloud/account/switch"
+	"github.com/databendcloud/bendsql/pkg/cmdutil"
+)
+
+// NewAccountCmd represents the account command
+func NewAccountCmd(f *cmdutil.Factory) *cobra.Command {
+	accountCmd := &cobra.Command{
+		Use:   "account",
+		Short: "Manage logged in accounts",
+		Long: `Manage the Databend Cloud accounts logged in to with the current profile. For example:
+            bendsql cloud account ls
+            bendsql cloud account switch app.databend.cn/alice@example.com
+`,
+	}
+	accountCmd.AddCommand(accountListCmd.NewCmdAccountList(f))
+	accountCmd.AddCommand(accountSwitchCmd.NewCmdAccountSwitch(f))
+	return accountCmd
+}
@@ -0,0 +1,63 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package account
+
+import (
+	"fmt"
+
+	"github.com/MakeNowJust/heredoc"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/databendcloud/bendsql/pkg/cmdutil"
+)
+
+func NewCmdAccountList(f *cmdutil.Factory) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ls",
+		Short: "show logged in accounts",
+		Long:  "show the accounts logged in to with the current profile, the active account is marked with *",
+		Args:  cobra.NoArgs,
+		Example: heredoc.Doc(`
+			# show logged in accounts
+			$ bendsql cloud account ls
+		`),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := f.Config()
+			if err != nil {
+				return errors.Wrap(err, "failed to get config")
+			}
+			var keys []string
+			p, ok := cfg.Profiles[cfg.ActiveProfile()]
+			if ok && p.Cloud != nil {
+				keys = p.Cloud.AccountKeys()
+			}
+			if len(keys) == 0 {
+				return cmdutil.NewNoResultsError("no accounts found, please use `bendsql cloud login` first")
+			}
+			for _, key := range keys {
+				mark := " "
+				if key == p.Cloud.Key() {
+					mark = "*"
+				}
+				account := p.Cloud.FindAccount(key)
+				fmt.Fprintf(f.IOStreams.Out, "%s %s\t%s/%s\n", mark, key, account.Org, account.Warehouse)
+			}
+			return nil
+		},
+	}
+
+	return cmd
+}
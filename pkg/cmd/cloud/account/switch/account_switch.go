@@ -0,0 +1,99 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package account
+
+import (
+	"fmt"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/MakeNowJust/heredoc"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/databendcloud/bendsql/internal/config"
+	"github.com/databendcloud/bendsql/pkg/cmdutil"
+	"github.com/databendcloud/bendsql/pkg/prompt"
+)
+
+func NewCmdAccountSwitch(f *cmdutil.Factory) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "switch [ACCOUNT]",
+		Short: "switch to another logged in account",
+		Long: heredoc.Doc(`
+			Switch the current profile to another logged in account without logging in again.
+
+			ACCOUNT is ENDPOINT/EMAIL as shown by 'bendsql cloud account ls', or only the
+			email if it is logged in to on a single endpoint. It is prompted for if omitted.
+		`),
+		Args: cobra.MaximumNArgs(1),
+		Example: heredoc.Doc(`
+			$ bendsql cloud account switch app.databend.cn/alice@example.com
+			$ bendsql cloud account switch bob@example.com
+		`),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := f.Config()
+			if err != nil {
+				return errors.Wrap(err, "failed to get config")
+			}
+			profile := cfg.ActiveProfile()
+			var account string
+			if len(args) > 0 {
+				account = args[0]
+			} else {
+				if !f.IOStreams.CanPrompt() {
+					return cmdutil.FlagErrorf("ACCOUNT is required when not running interactively")
+				}
+				p, ok := cfg.Profiles[profile]
+				if !ok || p.Cloud == nil || len(p.Cloud.Accounts) == 0 {
+					return errors.New("no other accounts found, please use `bendsql cloud login` to add one")
+				}
+				keys := p.Cloud.AccountKeys()
+				err = prompt.SurveyAskOne(
+					&survey.Select{
+						Message: "Select the account:",
+						Options: keys,
+						Default: keys[0],
+					}, &account, survey.WithValidator(survey.Required))
+				if err != nil {
+					return errors.Wrap(err, "could not prompt")
+				}
+			}
+
+			var key string
+			err = config.Update(func(cfg *config.Config) error {
+				p, err := cfg.Profile(profile)
+				if err != nil {
+					return err
+				}
+				if p.Cloud == nil {
+					return errors.New("please use `bendsql cloud login` to login your account first")
+				}
+				if err := p.Cloud.SwitchAccount(account); err != nil {
+					return err
+				}
+				p.Target = config.TARGET_CLOUD
+				key = p.Cloud.Key()
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(f.IOStreams.Out, "Now using account <%s>\n", key)
+			return nil
+		},
+	}
+
+	return cmd
+}
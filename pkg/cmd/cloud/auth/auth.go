@@ -0,0 +1,35 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"github.com/spf13/cobra"
+
+	authStatusCmd "github.com/databendcloud/bendsql/pkg/cmd/cloud/auth/status"
+	"github.com/databendcloud/bendsql/pkg/cmdutil"
+)
+
+// NewAuthCmd represents the auth command
+func NewAuthCmd(f *cmdutil.Factory) *cobra.Command {
+	authCmd := &cobra.Command{
+		Use:   "auth",
+		Short: "Inspect authentication with Databend Cloud",
+		Long: `Inspect authentication with Databend Cloud. For example:
+            bendsql cloud auth status
+`,
+	}
+	authCmd.AddCommand(authStatusCmd.NewCmdAuthStatus(f))
+	return authCmd
+}
@@ -0,0 +1,83 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/MakeNowJust/heredoc"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/databendcloud/bendsql/pkg/cmdutil"
+)
+
+func NewCmdAuthStatus(f *cmdutil.Factory) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show the authentication status",
+		Long:  "Show the account, org, endpoint and token of the active profile",
+		Args:  cobra.NoArgs,
+		Example: heredoc.Doc(`
+			$ bendsql cloud auth status
+		`),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			apiClient, err := f.APIClient()
+			if err != nil {
+				return errors.Wrap(err, "get api client failed")
+			}
+			info, err := apiClient.TokenInfo()
+			if err != nil {
+				return err
+			}
+			if info == nil {
+				return errors.Errorf("not logged in to %s, please use `bendsql cloud login` to login your account", apiClient.CurrentEndpoint())
+			}
+			account, err := apiClient.GetCurrentAccountInfo(cmd.Context())
+			if err != nil {
+				return err
+			}
+			// the token may have been refreshed by the request above
+			if info, err = apiClient.TokenInfo(); err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(f.IOStreams.Out, 0, 0, 2, ' ', 0)
+			fmt.Fprintf(w, "Endpoint:\t%s\n", apiClient.CurrentEndpoint())
+			fmt.Fprintf(w, "Account:\t%s <%s>\n", account.Name, account.Email)
+			fmt.Fprintf(w, "Org:\t%s\n", apiClient.CurrentOrganization())
+			fmt.Fprintf(w, "Warehouse:\t%s\n", apiClient.CurrentWarehouse())
+			fmt.Fprintf(w, "Token:\t%s\n", info.Source)
+			fmt.Fprintf(w, "Expires:\t%s\n", expiry(info.ExpiresAt))
+			fmt.Fprintf(w, "Refreshable:\t%t\n", info.Refreshable)
+			return w.Flush()
+		},
+	}
+
+	return cmd
+}
+
+func expiry(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	d := time.Until(t).Round(time.Second)
+	if d <= 0 {
+		return fmt.Sprintf("%s (expired)", t.Local().Format(time.RFC3339))
+	}
+	return fmt.Sprintf("%s (in %s)", t.Local().Format(time.RFC3339), d)
+}
@@ -17,9 +17,14 @@ package cloud
 import (
 	"github.com/spf13/cobra"
 
+	accountCmd "github.com/databendcloud/bendsql/pkg/cmd/cloud/account"
+	authCmd "github.com/databendcloud/bendsql/pkg/cmd/cloud/auth"
 	configureCmd "github.com/databendcloud/bendsql/pkg/cmd/cloud/configure"
+	endpointCmd "github.com/databendcloud/bendsql/pkg/cmd/cloud/endpoint"
 	loginCmd "github.com/databendcloud/bendsql/pkg/cmd/cloud/login"
+	logoutCmd "github.com/databendcloud/bendsql/pkg/cmd/cloud/logout"
 	warehouseCmd "github.com/databendcloud/bendsql/pkg/cmd/cloud/warehouse"
+	whoamiCmd "github.com/databendcloud/bendsql/pkg/cmd/cloud/whoami"
 	"github.com/databendcloud/bendsql/pkg/cmdutil"
 )
 
@@ -30,6 +35,8 @@ func NewCloudCmd(f *cmdutil.Factory) *cobra.Command {
 		Short: "Operate Databend Cloud",
 		Long: `Operate Databend Cloud. For example:
             bendsql cloud login
+            bendsql cloud auth status
+            bendsql cloud account switch
             bendsql cloud warehouse ls
             bendsql cloud warehouse status YOUR_WAREHOUSE
             bendsql cloud warehouse suspend YOUR_WAREHOUSE`,
@@ -39,6 +46,11 @@ func NewCloudCmd(f *cmdutil.Factory) *cobra.Command {
 	}
 	cloudCmd.AddCommand(configureCmd.NewCmdConfigure(f))
 	cloudCmd.AddCommand(loginCmd.NewCmdLogin(f))
+	cloudCmd.AddCommand(logoutCmd.NewCmdLogout(f))
+	cloudCmd.AddCommand(authCmd.NewAuthCmd(f))
+	cloudCmd.AddCommand(accountCmd.NewAccountCmd(f))
+	cloudCmd.AddCommand(endpointCmd.NewEndpointCmd(f))
+	cloudCmd.AddCommand(whoamiCmd.NewCmdWhoami(f))
 	cloudCmd.AddCommand(warehouseCmd.NewWarehouseCmd(f))
 
 	return cloudCmd
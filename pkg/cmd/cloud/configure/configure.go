@@ -47,11 +47,11 @@ func NewCmdConfigure(f *cmdutil.Factory) *cobra.Command {
 			$ bendsql cloud configure
 		`),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			apiClient, err := api.NewClient()
+			apiClient, err := f.APIClient()
 			if err != nil {
 				return errors.Wrap(err, "new api client failed")
 			}
-			orgDtos, err := apiClient.ListOrgs()
+			orgDtos, err := apiClient.ListOrgs(cmd.Context())
 			if err != nil {
 				return errors.Wrap(err, "list orgs failed")
 			}
@@ -68,7 +68,7 @@ func NewCmdConfigure(f *cmdutil.Factory) *cobra.Command {
 				}
 			}
 
-			warehouseDtos, err := apiClient.ListWarehouses()
+			warehouseDtos, err := apiClient.ListWarehouses(cmd.Context())
 			if err != nil {
 				return errors.Wrap(err, "list warehouses failed")
 			}
@@ -78,7 +78,7 @@ func NewCmdConfigure(f *cmdutil.Factory) *cobra.Command {
 					return errors.Wrap(err, "ask for warehouse failed")
 				}
 			}
-			err = apiClient.SetCurrentWarehouse(opts.Warehouse)
+			err = apiClient.SetCurrentWarehouse(cmd.Context(), opts.Warehouse)
 			if err != nil {
 				return errors.Wrap(err, "set current warehouse failed")
 			}
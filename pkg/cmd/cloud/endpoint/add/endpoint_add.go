@@ -0,0 +1,68 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package endpoint
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/MakeNowJust/heredoc"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/databendcloud/bendsql/api"
+	"github.com/databendcloud/bendsql/internal/config"
+	"github.com/databendcloud/bendsql/pkg/cmdutil"
+)
+
+func NewCmdEndpointAdd(f *cmdutil.Factory) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "add NAME URL",
+		Short: "add a private endpoint",
+		Long: heredoc.Docf(`
+			Add a private Databend Cloud endpoint, so that it is offered by 'bendsql cloud login'
+			and can be given by NAME to --endpoint and BENDSQL_API_ENDPOINT.
+
+			The endpoint is checked by fetching its metadata from %s, which also tells
+			the API version, auth methods and regions it supports.
+		`, api.MetadataPath),
+		Args: cobra.ExactArgs(2),
+		Example: heredoc.Doc(`
+			$ bendsql cloud endpoint add acme https://databend.acme.internal
+		`),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+			endpoint, err := config.ParseEndpoint(args[1])
+			if err != nil {
+				return cmdutil.FlagErrorf("%v", err)
+			}
+			metadata, err := api.DiscoverEndpoint(cmd.Context(), endpoint)
+			if err != nil {
+				return err
+			}
+			err = config.Update(func(cfg *config.Config) error {
+				return cfg.AddEndpoint(name, metadata.Endpoint(endpoint))
+			})
+			if err != nil {
+				return errors.Wrap(err, "write config failed")
+			}
+			fmt.Fprintf(f.IOStreams.Out, "Added endpoint <%s> %s, auth methods: %s\n",
+				name, endpoint, strings.Join(metadata.AuthMethods, ", "))
+			return nil
+		},
+	}
+
+	return cmd
+}
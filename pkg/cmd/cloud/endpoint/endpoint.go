@@ -0,0 +1,41 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package endpoint
+
+import (
+	"github.com/spf13/cobra"
+
+	endpointAddCmd "github.com/databendcloud/bendsql/pkg/cmd/cloud/endpoint/add"
+	endpointListCmd "github.com/databendcloud/bendsql/pkg/cmd/cloud/endpoint/ls"
+	endpointRemoveCmd "github.com/databendcloud/bendsql/pkg/cmd/cloud/endpoint/rm"
+	"github.com/databendcloud/bendsql/pkg/cmdutil"
+)
+
+// NewEndpointCmd represents the endpoint command
+func NewEndpointCmd(f *cmdutil.Factory) *cobra.Command {
+	endpointCmd := &cobra.Command{
+		Use:   "endpoint",
+		Short: "Manage private Databend Cloud endpoints",
+		Long: `Manage the Databend Cloud endpoints offered by bendsql cloud login. For example:
+            bendsql cloud endpoint add acme https://databend.acme.internal
+            bendsql cloud endpoint ls
+            bendsql cloud login --endpoint acme
+`,
+	}
+	endpointCmd.AddCommand(endpointAddCmd.NewCmdEndpointAdd(f))
+	endpointCmd.AddCommand(endpointListCmd.NewCmdEndpointList(f))
+	endpointCmd.AddCommand(endpointRemoveCmd.NewCmdEndpointRemove(f))
+	return endpointCmd
+}
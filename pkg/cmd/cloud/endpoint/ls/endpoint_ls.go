@@ -0,0 +1,55 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package endpoint
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/MakeNowJust/heredoc"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/databendcloud/bendsql/api"
+	"github.com/databendcloud/bendsql/pkg/cmdutil"
+)
+
+func NewCmdEndpointList(f *cmdutil.Factory) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ls",
+		Short: "show endpoints",
+		Long:  "show the built-in and added endpoints",
+		Args:  cobra.NoArgs,
+		Example: heredoc.Doc(`
+			$ bendsql cloud endpoint ls
+		`),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := f.Config()
+			if err != nil {
+				return errors.Wrap(err, "failed to get config")
+			}
+			fmt.Fprintf(f.IOStreams.Out, "global\t%s\n", api.EndpointGlobal)
+			fmt.Fprintf(f.IOStreams.Out, "cn\t%s\n", api.EndpointCN)
+			for _, name := range cfg.EndpointNames() {
+				e := cfg.Endpoints[name]
+				fmt.Fprintf(f.IOStreams.Out, "%s\t%s\t%s\t%s\n", name, e.URL,
+					strings.Join(e.AuthMethods, ","), strings.Join(e.Regions, ","))
+			}
+			return nil
+		},
+	}
+
+	return cmd
+}
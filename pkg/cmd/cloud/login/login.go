@@ -15,8 +15,10 @@
 package auth
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/AlecAivazis/survey/v2"
 	"github.com/MakeNowJust/heredoc"
@@ -25,15 +27,19 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/databendcloud/bendsql/api"
+	"github.com/databendcloud/bendsql/internal/config"
 	"github.com/databendcloud/bendsql/pkg/cmdutil"
 	"github.com/databendcloud/bendsql/pkg/prompt"
 )
 
 type LoginOptions struct {
-	Email    string
-	Password string
-	Org      string
-	Endpoint string
+	Email     string
+	Password  string
+	Org       string
+	Endpoint  string
+	Web       bool
+	WithToken bool
+	TokenFile string
 }
 
 func NewCmdLogin(f *cmdutil.Factory) *cobra.Command {
@@ -45,10 +51,18 @@ func NewCmdLogin(f *cmdutil.Factory) *cobra.Command {
 		Long: heredoc.Docf(`
 			Authenticate with a Databend Cloud host.
 
-			The default authentication mode is a user-password flow. After completion, an
-			authentication token will be stored internally.
+			The default authentication mode is a user-password flow. With --web, bendsql
+			opens the Databend Cloud sign-in page in the browser instead, which also works
+			for SSO accounts. After completion, an authentication token will be stored internally.
 
-			Alternatively, bendcli will use the authentication token found in environment variables.`,
+			Logging in to another endpoint or account keeps the accounts logged in to before,
+			use 'bendsql cloud account switch' to switch back to them.
+
+			For automation, an API key or personal access token can be read from standard input
+			with --with-token or from a file with --token-file. Such tokens are never refreshed.
+
+			Alternatively, bendsql will use the token found in the BENDSQL_TOKEN environment
+			variable without storing it.`,
 		),
 		Example: heredoc.Doc(`
 			# start interactive setup
@@ -56,37 +70,63 @@ func NewCmdLogin(f *cmdutil.Factory) *cobra.Command {
 
 			# authenticate by reading the token from a file
 			$ bendsql cloud login --email EMAIL --password PASSWORD [--org ORG]
+
+			# authenticate in the browser
+			$ bendsql cloud login --web
+
+			# authenticate with an API key in CI
+			$ echo "$DATABEND_API_KEY" | bendsql cloud login --with-token --endpoint https://app.databend.com --org ORG
+			$ bendsql cloud login --token-file /run/secrets/databend --org ORG
 		`),
 		Annotations: map[string]string{
 			"IsCore": "true",
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return loginRun(opts)
+			if err := cmdutil.MutuallyExclusive(
+				"specify only one of `--web`, `--with-token`, `--token-file` or `--email` and `--password`",
+				opts.Web, opts.WithToken, opts.TokenFile != "", opts.Email != "" || opts.Password != "",
+			); err != nil {
+				return err
+			}
+			return loginRun(cmd.Context(), f, opts)
 		},
 	}
 
 	cmd.Flags().StringVarP(&opts.Org, "org", "", "", "org")
 	cmd.Flags().StringVarP(&opts.Email, "email", "", "", "email")
 	cmd.Flags().StringVarP(&opts.Password, "password", "", "", "password")
-	cmd.Flags().StringVarP(&opts.Endpoint, "endpoint", "", "", "endpoint")
+	cmd.Flags().StringVarP(&opts.Endpoint, "endpoint", "", "", "Endpoint URL or the name of an added endpoint")
+	cmd.Flags().BoolVarP(&opts.Web, "web", "", false, "Sign in with the browser")
+	cmd.Flags().BoolVarP(&opts.WithToken, "with-token", "", false, "Read an API key or access token from standard input")
+	cmd.Flags().StringVarP(&opts.TokenFile, "token-file", "", "", "Read an API key or access token from a file")
 	return cmd
 }
 
-func loginRun(opts *LoginOptions) error {
-	apiClient, err := api.NewClient()
+func loginRun(ctx context.Context, f *cmdutil.Factory, opts *LoginOptions) error {
+	apiClient, err := f.APIClient()
 	if err != nil {
 		return errors.Wrap(err, "could not create api client")
 	}
 
+	cfg, err := f.Config()
+	if err != nil {
+		return errors.Wrap(err, "failed to get config")
+	}
+
 	if endpoint := os.Getenv("BENDSQL_API_ENDPOINT"); endpoint != "" {
 		opts.Endpoint = endpoint
 	}
+	canPrompt := f.IOStreams.CanPrompt()
+	if opts.Endpoint == "" && !canPrompt {
+		opts.Endpoint = apiClient.CurrentEndpoint()
+	}
 	// interactive select endpoint
 	if opts.Endpoint == "" {
+		options := append([]string{api.EndpointGlobal, api.EndpointCN}, cfg.EndpointNames()...)
 		err = prompt.SurveyAskOne(
 			&survey.Select{
 				Message: "Select your login endpoint:",
-				Options: []string{api.EndpointGlobal, api.EndpointCN},
+				Options: options,
 				Default: api.EndpointGlobal,
 				Description: func(value string, index int) string {
 					switch value {
@@ -95,7 +135,7 @@ func loginRun(opts *LoginOptions) error {
 					case api.EndpointCN:
 						return "China"
 					default:
-						return ""
+						return cfg.EndpointURL(value)
 					}
 				},
 			}, &opts.Endpoint, survey.WithValidator(survey.Required))
@@ -103,33 +143,79 @@ func loginRun(opts *LoginOptions) error {
 			return errors.Wrap(err, "could not prompt")
 		}
 	}
+	registered := cfg.Endpoints[opts.Endpoint]
+	endpoint, err := config.ParseEndpoint(cfg.EndpointURL(opts.Endpoint))
+	if err != nil {
+		return cmdutil.FlagErrorf("%v", err)
+	}
 
-	// interactive login
-	if opts.Email == "" {
-		err = prompt.SurveyAskOne(
-			&survey.Input{
-				Message: "Paste your user email:",
-			}, &opts.Email, survey.WithValidator(survey.Required))
-		if err != nil {
-			return errors.Wrap(err, "could not prompt")
+	method := api.AuthMethodPassword
+	switch {
+	case opts.WithToken || opts.TokenFile != "" || (config.EnvToken() != nil && opts.Email == ""):
+		method = api.AuthMethodToken
+	case opts.Web:
+		method = api.AuthMethodWeb
+	}
+	if err := api.CheckAuthMethod(registered, method); err != nil {
+		return err
+	}
+	// BENDSQL_TOKEN is not stored, other tokens are sealed into the
+	// credential store, which can not prompt for its passphrase now
+	envToken := method == api.AuthMethodToken && !opts.WithToken && opts.TokenFile == ""
+	if !canPrompt && !envToken {
+		if err := cfg.CheckCredentialStore(); err != nil {
+			return err
 		}
 	}
-	if opts.Password == "" {
-		err = prompt.SurveyAskOne(&survey.Password{
-			Message: "Paste your password:",
-		}, &opts.Password, survey.WithValidator(survey.Required))
+
+	apiClient.SetEndpoint(endpoint)
+	switch {
+	case opts.WithToken || opts.TokenFile != "":
+		file := opts.TokenFile
+		if opts.WithToken {
+			file = "-"
+		}
+		content, err := f.IOStreams.ReadUserFile(file)
 		if err != nil {
-			return errors.Wrap(err, "could not prompt")
+			return errors.Wrap(err, "failed to read token")
+		}
+		token := strings.TrimSpace(string(content))
+		if token == "" {
+			return errors.New("the token is empty")
+		}
+		apiClient.LoginWithToken(token)
+	case opts.Web:
+		err = apiClient.LoginWeb(ctx, api.WebLoginOptions{
+			OpenURL: func(url string) error {
+				fmt.Fprintf(f.IOStreams.ErrOut, "Opening %s in your browser.\n", url)
+				if err := cmdutil.OpenBrowser(url); err != nil {
+					fmt.Fprintf(f.IOStreams.ErrOut, "Failed to open the browser, please open the URL above manually: %v\n", err)
+				}
+				return nil
+			},
+		})
+		if err != nil {
+			return err
+		}
+	case config.EnvToken() != nil && opts.Email == "":
+		// BENDSQL_TOKEN is used for the requests below but not stored
+		apiClient.LoginWithEnvToken()
+	default:
+		if !canPrompt && (opts.Email == "" || opts.Password == "") {
+			return cmdutil.FlagErrorf("no credential available, please use --with-token, --token-file, %s or --email and --password when not running interactively", config.TokenEnv)
+		}
+		if err = passwordLogin(ctx, apiClient, opts); err != nil {
+			return err
 		}
 	}
 
-	apiClient.SetEndpoint(opts.Endpoint)
-	err = apiClient.Login(opts.Email, opts.Password)
+	account, err := apiClient.GetCurrentAccountInfo(ctx)
 	if err != nil {
 		return err
 	}
+	apiClient.SetAccount(account.Email)
 
-	orgDtos, err := apiClient.ListOrgs()
+	orgDtos, err := apiClient.ListOrgs(ctx)
 	if err != nil {
 		return errors.Wrap(err, "list orgs failed")
 	}
@@ -141,6 +227,9 @@ func loginRun(opts *LoginOptions) error {
 	case 1:
 		currentOrg = &orgDtos[0]
 	default:
+		if opts.Org == "" && !canPrompt {
+			return cmdutil.FlagErrorf("found %d orgs, please use --org to select one when not running interactively", len(orgDtos))
+		}
 		if opts.Org == "" {
 			var orgs []string
 			for i := range orgDtos {
@@ -177,8 +266,30 @@ func loginRun(opts *LoginOptions) error {
 		return errors.Wrap(err, "could not write config")
 	}
 
-	logrus.Infof("logged in %s of Databend Cloud %s successfully.",
-		apiClient.CurrentOrganization(), apiClient.CurrentEndpoint())
+	logrus.Infof("logged in %s of Databend Cloud %s as %s successfully.",
+		apiClient.CurrentOrganization(), apiClient.CurrentEndpoint(), apiClient.CurrentAccount())
 	logrus.Infoln("you can use `bendsql cloud configure` to switch to another org and warehouse")
 	return nil
 }
+
+func passwordLogin(ctx context.Context, apiClient *api.Client, opts *LoginOptions) error {
+	// interactive login
+	if opts.Email == "" {
+		err := prompt.SurveyAskOne(
+			&survey.Input{
+				Message: "Paste your user email:",
+			}, &opts.Email, survey.WithValidator(survey.Required))
+		if err != nil {
+			return errors.Wrap(err, "could not prompt")
+		}
+	}
+	if opts.Password == "" {
+		err := prompt.SurveyAskOne(&survey.Password{
+			Message: "Paste your password:",
+		}, &opts.Password, survey.WithValidator(survey.Required))
+		if err != nil {
+			return errors.Wrap(err, "could not prompt")
+		}
+	}
+	return apiClient.Login(ctx, opts.Email, opts.Password)
+}
@@ -0,0 +1,106 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/databendcloud/bendsql/api"
+	"github.com/databendcloud/bendsql/api/apitest"
+	"github.com/databendcloud/bendsql/internal/config"
+	"github.com/databendcloud/bendsql/pkg/cmdutil"
+	"github.com/databendcloud/bendsql/pkg/iostreams"
+)
+
+// runLogin runs `bendsql cloud login args` without a terminal, stdin is
+// what the command reads from standard input.
+func runLogin(args, stdin string) error {
+	ios, in, stdout, _ := iostreams.Test()
+	in.WriteString(stdin)
+	f := &cmdutil.Factory{
+		IOStreams: ios,
+		Config:    config.GetConfig,
+		APIClient: func() (*api.Client, error) {
+			cfg, err := config.GetConfig()
+			if err != nil {
+				return nil, err
+			}
+			return api.NewClient(cfg)
+		},
+	}
+	cmd := NewCmdLogin(f)
+	cmd.SetArgs(strings.Fields(args))
+	cmd.SetOut(stdout)
+	cmd.SetErr(stdout)
+	_, err := cmd.ExecuteC()
+	return err
+}
+
+func TestLoginWithTokenWithoutTerminal(t *testing.T) {
+	srv := apitest.NewServer()
+	defer srv.Close()
+	t.Setenv("BENDSQL_CONFIG", filepath.Join(t.TempDir(), "config.toml"))
+	t.Setenv("BENDSQL_VAULT_PASSPHRASE", "")
+
+	login := func() error {
+		return runLogin("--with-token --endpoint "+srv.URL+" --org "+apitest.DefaultOrg, apitest.DefaultAPIKey+"\n")
+	}
+
+	// the vault can not ask for its passphrase, so nothing is sent
+	err := login()
+	assert.ErrorContains(t, err, "please set BENDSQL_VAULT_PASSPHRASE")
+	assert.Empty(t, srv.Requests())
+
+	t.Setenv("BENDSQL_VAULT_PASSPHRASE", "correct horse")
+	assert.NoError(t, login())
+	cfg, err := config.GetConfig()
+	assert.NoError(t, err)
+	p, err := cfg.Profile(config.DefaultProfile)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(p.Cloud.Token.AccessToken, "ref:vault:"), p.Cloud.Token.AccessToken)
+}
+
+func TestLoginWithEnvTokenOnOtherEndpoint(t *testing.T) {
+	srv1 := apitest.NewServer()
+	defer srv1.Close()
+	srv2 := apitest.NewServer(apitest.WithUser("other@example.com", "secret"))
+	defer srv2.Close()
+	t.Setenv("BENDSQL_CONFIG", filepath.Join(t.TempDir(), "config.toml"))
+	t.Setenv("BENDSQL_VAULT_PASSPHRASE", "correct horse")
+
+	args := "--endpoint " + srv1.URL + " --email " + apitest.DefaultEmail + " --password " + apitest.DefaultPassword
+	assert.NoError(t, runLogin(args, ""))
+
+	// the session of srv1 must not be saved for the account of srv2
+	t.Setenv(config.TokenEnv, apitest.DefaultAPIKey)
+	assert.NoError(t, runLogin("--endpoint "+srv2.URL, ""))
+
+	cfg, err := config.GetConfig()
+	assert.NoError(t, err)
+	p, err := cfg.Profile(config.DefaultProfile)
+	assert.NoError(t, err)
+	other := p.Cloud.FindAccount(config.AccountKey(srv2.URL, "other@example.com"))
+	if assert.NotNil(t, other) {
+		assert.Nil(t, other.Token)
+	}
+	first := p.Cloud.FindAccount(config.AccountKey(srv1.URL, apitest.DefaultEmail))
+	if assert.NotNil(t, first) {
+		assert.NotNil(t, first.Token)
+	}
+}
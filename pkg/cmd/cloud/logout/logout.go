@@ -0,0 +1,87 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"fmt"
+
+	"github.com/MakeNowJust/heredoc"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/databendcloud/bendsql/internal/config"
+	"github.com/databendcloud/bendsql/pkg/cmdutil"
+)
+
+func NewCmdLogout(f *cmdutil.Factory) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "logout",
+		Short: "Log out of Databend Cloud",
+		Long: heredoc.Doc(`
+			Log out of Databend Cloud.
+
+			The session of the active account is revoked on the server when possible, and
+			its token is removed from the config file and the credential store. Other
+			accounts logged in to with the profile stay logged in.
+		`),
+		Args: cobra.NoArgs,
+		Example: heredoc.Doc(`
+			$ bendsql cloud logout
+			$ bendsql --profile prod cloud logout
+		`),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			apiClient, err := f.APIClient()
+			if err != nil {
+				return errors.Wrap(err, "get api client failed")
+			}
+			profile := apiClient.CurrentProfile()
+			cfg, err := f.Config()
+			if err != nil {
+				return errors.Wrap(err, "get config failed")
+			}
+			if p, ok := cfg.Profiles[profile]; !ok || p.Cloud == nil || p.Cloud.Token == nil {
+				return cmdutil.NewNoResultsError(fmt.Sprintf("profile %s is not logged in to Databend Cloud", profile))
+			}
+			if err := apiClient.Logout(cmd.Context()); err != nil {
+				logrus.Warnf("%v, the token is removed locally only", err)
+			}
+			others := 0
+			err = config.Update(func(cfg *config.Config) error {
+				if err := cfg.RemoveToken(profile); err != nil {
+					logrus.Warnf("failed to delete the token from the credential store: %v", err)
+				}
+				if p, ok := cfg.Profiles[profile]; ok && p.Cloud != nil {
+					others = len(p.Cloud.Accounts)
+				}
+				return nil
+			})
+			if err != nil {
+				return errors.Wrap(err, "write config failed")
+			}
+			key := config.AccountKey(apiClient.CurrentEndpoint(), apiClient.CurrentAccount())
+			fmt.Fprintf(f.IOStreams.Out, "Logged out of %s for profile %s.\n", key, profile)
+			if others > 0 {
+				fmt.Fprintf(f.IOStreams.Out, "%d other accounts are still logged in, use `bendsql cloud account switch` to use one of them.\n", others)
+			}
+			if config.EnvToken() != nil {
+				fmt.Fprintf(f.IOStreams.ErrOut, "%s is still set in the environment.\n", config.TokenEnv)
+			}
+			return nil
+		},
+	}
+
+	return cmd
+}
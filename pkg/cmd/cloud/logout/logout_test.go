@@ -0,0 +1,53 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/databendcloud/bendsql/api"
+	"github.com/databendcloud/bendsql/internal/config"
+	"github.com/databendcloud/bendsql/pkg/cmdutil"
+	"github.com/databendcloud/bendsql/pkg/iostreams"
+)
+
+func TestLogoutNotLoggedIn(t *testing.T) {
+	t.Setenv("BENDSQL_CONFIG", filepath.Join(t.TempDir(), "config.toml"))
+	ios, _, stdout, _ := iostreams.Test()
+	f := &cmdutil.Factory{
+		IOStreams: ios,
+		Config:    config.GetConfig,
+		APIClient: func() (*api.Client, error) {
+			cfg, err := config.GetConfig()
+			if err != nil {
+				return nil, err
+			}
+			return api.NewClient(cfg)
+		},
+	}
+	cmd := NewCmdLogout(f)
+	cmd.SetArgs(nil)
+	cmd.SetOut(stdout)
+	cmd.SetErr(stdout)
+
+	_, err := cmd.ExecuteC()
+	var noResults cmdutil.NoResultsError
+	assert.ErrorAs(t, err, &noResults)
+	assert.EqualError(t, err, "profile default is not logged in to Databend Cloud")
+	assert.NotContains(t, stdout.String(), "Logged out")
+}
@@ -15,13 +15,13 @@
 package warehouse
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/MakeNowJust/heredoc"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 
-	"github.com/databendcloud/bendsql/api"
 	"github.com/databendcloud/bendsql/pkg/cmdutil"
 )
 
@@ -43,11 +43,11 @@ func NewCmdWarehouseCreate(f *cmdutil.Factory) *cobra.Command {
 			if len(args) == 0 {
 				return errors.New("warehouse name is required")
 			}
-			err := createWarehouse(f, args[0], size, tag)
+			err := createWarehouse(cmd.Context(), f, args[0], size, tag)
 			if err != nil {
-				return errors.Errorf("create warehouse %s failed, err: %v", args[0], err)
+				return errors.Wrapf(err, "create warehouse %s failed", args[0])
 			}
-			fmt.Printf("warehouse %s created, size is %s\n", args[0], size)
+			fmt.Fprintf(f.IOStreams.Out, "warehouse %s created, size is %s\n", args[0], size)
 			return nil
 		},
 	}
@@ -57,13 +57,13 @@ func NewCmdWarehouseCreate(f *cmdutil.Factory) *cobra.Command {
 	return cmd
 }
 
-func createWarehouse(f *cmdutil.Factory, warehouseName, size, tag string) error {
-	fmt.Printf("warehouse %s is creating, please wait...\n", warehouseName)
-	apiClient, err := api.NewClient()
+func createWarehouse(ctx context.Context, f *cmdutil.Factory, warehouseName, size, tag string) error {
+	fmt.Fprintf(f.IOStreams.Out, "warehouse %s is creating, please wait...\n", warehouseName)
+	apiClient, err := f.CloudAPI()
 	if err != nil {
 		return err
 	}
-	err = apiClient.CreateWarehouse(warehouseName, size, tag)
+	err = apiClient.CreateWarehouse(ctx, warehouseName, size, tag)
 	if err != nil {
 		return err
 	}
@@ -15,13 +15,13 @@
 package warehouse
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/MakeNowJust/heredoc"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 
-	"github.com/databendcloud/bendsql/api"
 	"github.com/databendcloud/bendsql/pkg/cmdutil"
 )
 
@@ -41,23 +41,23 @@ func NewCmdWarehouseDelete(f *cmdutil.Factory) *cobra.Command {
 			if len(args) == 0 {
 				return errors.New("warehouse name is required")
 			}
-			err := deleteWarehouse(f, args[0])
+			err := deleteWarehouse(cmd.Context(), f, args[0])
 			if err != nil {
 				return errors.Errorf("Delete warehouse %s failed, err: %v", args[0], err)
 			}
-			fmt.Printf("Warehouse %s deleted.\n", args[0])
+			fmt.Fprintf(f.IOStreams.Out, "Warehouse %s deleted.\n", args[0])
 			return nil
 		},
 	}
 	return cmd
 }
 
-func deleteWarehouse(f *cmdutil.Factory, warehouseName string) error {
-	apiClient, err := api.NewClient()
+func deleteWarehouse(ctx context.Context, f *cmdutil.Factory, warehouseName string) error {
+	apiClient, err := f.CloudAPI()
 	if err != nil {
 		return err
 	}
-	err = apiClient.DeleteWarehouse(warehouseName)
+	err = apiClient.DeleteWarehouse(ctx, warehouseName)
 	if err != nil {
 		return err
 	}
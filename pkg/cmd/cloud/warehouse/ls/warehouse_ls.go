@@ -21,7 +21,6 @@ import (
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 
-	"github.com/databendcloud/bendsql/api"
 	"github.com/databendcloud/bendsql/pkg/cmdutil"
 )
 
@@ -35,16 +34,16 @@ func NewCmdWarehouseList(f *cmdutil.Factory) *cobra.Command {
 			$ bendsql cloud warehouse ls
 		`),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			apiClient, err := api.NewClient()
+			apiClient, err := f.CloudAPI()
 			if err != nil {
 				return errors.Wrap(err, "get api client failed")
 			}
-			warehouseList, err := apiClient.ListWarehouses()
+			warehouseList, err := apiClient.ListWarehouses(cmd.Context())
 			if err != nil {
 				return errors.Wrap(err, "list warehouses failed")
 			}
 			for _, warehouse := range warehouseList {
-				fmt.Println(warehouse.Description(), warehouse.Name)
+				fmt.Fprintln(f.IOStreams.Out, warehouse.Description(), warehouse.Name)
 			}
 			return nil
 		},
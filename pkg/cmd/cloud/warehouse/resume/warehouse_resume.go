@@ -15,11 +15,12 @@
 package warehouse
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"time"
 
 	"github.com/MakeNowJust/heredoc"
-	"github.com/avast/retry-go"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 
@@ -46,7 +47,7 @@ func NewCmdWarehouseResume(f *cmdutil.Factory) *cobra.Command {
 			$ bendsql cloud warehouse resume [WAREHOUSE]
 		`),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			apiClient, err := api.NewClient()
+			apiClient, err := f.CloudAPI()
 			if err != nil {
 				return errors.Wrap(err, "get api client failed")
 			}
@@ -59,7 +60,7 @@ func NewCmdWarehouseResume(f *cmdutil.Factory) *cobra.Command {
 			default:
 				return errors.New("wrong params")
 			}
-			err = resumeWarehouse(apiClient, warehouse, wait, timeout)
+			err = resumeWarehouse(cmd.Context(), f.IOStreams.Out, apiClient, warehouse, wait, timeout)
 			if err != nil {
 				return errors.Wrapf(err, "resume warehouse %s failed", warehouse)
 			}
@@ -71,32 +72,19 @@ func NewCmdWarehouseResume(f *cmdutil.Factory) *cobra.Command {
 	return cmd
 }
 
-func resumeWarehouse(apiClient *api.Client, warehouseName string, wait bool, timeout time.Duration) error {
-	err := apiClient.ResumeWarehouse(warehouseName)
+func resumeWarehouse(ctx context.Context, out io.Writer, apiClient api.CloudAPI, warehouseName string, wait bool, timeout time.Duration) error {
+	err := apiClient.ResumeWarehouse(ctx, warehouseName)
 	if err != nil {
 		return errors.Wrap(err, "resume warehouse failed")
 	}
 
 	if wait {
-		err = retry.Do(
-			func() (err error) {
-				status, err := apiClient.ViewWarehouse(warehouseName)
-				if err != nil {
-					panic(err)
-				}
-				if status.State != "Running" {
-					return fmt.Errorf("resume warehouse %s timeout, state is %s", warehouseName, status.State)
-				}
-				fmt.Printf("Resume warehouse %s succeed.\n", warehouseName)
-				return nil
-			},
-			retry.Delay(1*time.Second),
-			retry.Attempts(uint(timeout/time.Second)),
-		)
+		err = apiClient.WaitWarehouseRunning(ctx, warehouseName, timeout)
 		if err != nil {
 			return errors.Wrap(err, "wait for resume warehouse failed")
 		}
+		fmt.Fprintf(out, "Resume warehouse %s succeed.\n", warehouseName)
 	}
-	fmt.Printf("Resume warehouse %s done, please check with `bendsql cloud warehouse status [WAREHOUSE]`\n", warehouseName)
+	fmt.Fprintf(out, "Resume warehouse %s done, please check with `bendsql cloud warehouse status [WAREHOUSE]`\n", warehouseName)
 	return nil
 }
@@ -21,7 +21,6 @@ import (
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 
-	"github.com/databendcloud/bendsql/api"
 	"github.com/databendcloud/bendsql/pkg/cmdutil"
 )
 
@@ -37,7 +36,7 @@ func NewCmdWarehouseStatus(f *cmdutil.Factory) *cobra.Command {
 			$ bendsql cloud warehouse status [WAREHOUSE]
 		`),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			apiClient, err := api.NewClient()
+			apiClient, err := f.CloudAPI()
 			if err != nil {
 				return errors.Wrap(err, "new api client failed")
 			}
@@ -51,11 +50,11 @@ func NewCmdWarehouseStatus(f *cmdutil.Factory) *cobra.Command {
 				return errors.Wrap(err, "wrong params")
 			}
 
-			warehouseStatus, err := apiClient.ViewWarehouse(warehouse)
+			warehouseStatus, err := apiClient.ViewWarehouse(cmd.Context(), warehouse)
 			if err != nil {
 				return errors.Wrap(err, "show warehouse status failed")
 			}
-			fmt.Printf("Warehouse %s status is %s, size is %s, readyInstance is %d, totalInstance is %d\n",
+			fmt.Fprintf(f.IOStreams.Out, "Warehouse %s status is %s, size is %s, readyInstance is %d, totalInstance is %d\n",
 				warehouseStatus.Name, warehouseStatus.State,
 				warehouseStatus.Size, warehouseStatus.ReadyInstances,
 				warehouseStatus.TotalInstances)
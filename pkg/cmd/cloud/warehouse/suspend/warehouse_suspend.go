@@ -21,7 +21,6 @@ import (
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 
-	"github.com/databendcloud/bendsql/api"
 	"github.com/databendcloud/bendsql/pkg/cmdutil"
 )
 
@@ -36,7 +35,7 @@ func NewCmdWarehouseSuspend(f *cmdutil.Factory) *cobra.Command {
 			$ bendsql cloud warehouse suspend [WAREHOUSE]
 		`),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			apiClient, err := api.NewClient()
+			apiClient, err := f.CloudAPI()
 			if err != nil {
 				return errors.Wrap(err, "get api client failed")
 			}
@@ -49,11 +48,11 @@ func NewCmdWarehouseSuspend(f *cmdutil.Factory) *cobra.Command {
 			default:
 				return errors.New("wrong params")
 			}
-			err = apiClient.SuspendWarehouse(warehouse)
+			err = apiClient.SuspendWarehouse(cmd.Context(), warehouse)
 			if err != nil {
 				return errors.Wrapf(err, "suspend warehouse %s failed", warehouse)
 			}
-			fmt.Printf("Suspend warehouse %s succeed, you can check with `bendsql cloud warehouse status WAREHOUSE`\n", warehouse)
+			fmt.Fprintf(f.IOStreams.Out, "Suspend warehouse %s succeed, you can check with `bendsql cloud warehouse status WAREHOUSE`\n", warehouse)
 			return nil
 		},
 	}
@@ -21,7 +21,6 @@ import (
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 
-	"github.com/databendcloud/bendsql/api"
 	"github.com/databendcloud/bendsql/pkg/cmdutil"
 )
 
@@ -36,12 +35,12 @@ func NewCmdWarehouseUse(f *cmdutil.Factory) *cobra.Command {
 			$ bendsql cloud warehouse use [WAREHOUSE]
 		`),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			apiClient, err := api.NewClient()
+			apiClient, err := f.APIClient()
 			if err != nil {
 				return errors.Wrap(err, "get api client failed")
 			}
 			warehouse := args[0]
-			err = apiClient.SetCurrentWarehouse(warehouse)
+			err = apiClient.SetCurrentWarehouse(cmd.Context(), warehouse)
 			if err != nil {
 				return errors.Wrapf(err, "set working warehouse %s failed", warehouse)
 			}
@@ -50,7 +49,7 @@ func NewCmdWarehouseUse(f *cmdutil.Factory) *cobra.Command {
 				return errors.Wrap(err, "write config failed")
 			}
 
-			fmt.Printf("Now using warehouse <%s>\n", warehouse)
+			fmt.Fprintf(f.IOStreams.Out, "Now using warehouse <%s>\n", warehouse)
 			return nil
 		},
 	}
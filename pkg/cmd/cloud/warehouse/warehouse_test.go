@@ -0,0 +1,83 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package warehouse
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/shlex"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/databendcloud/bendsql/api"
+	"github.com/databendcloud/bendsql/api/apitest"
+	"github.com/databendcloud/bendsql/pkg/cmdutil"
+	"github.com/databendcloud/bendsql/pkg/iostreams"
+)
+
+func TestWarehouseCmd(t *testing.T) {
+	srv := apitest.NewServer(apitest.WithStartDelay(50 * time.Millisecond))
+	defer srv.Close()
+	srv.AddWarehouse("w1", "Small", apitest.StateSuspended)
+
+	tests := []struct {
+		args    string
+		wantOut string
+		wantErr string
+		state   string
+	}{
+		{args: "ls", wantOut: "⚪️ (Small) w1\n"},
+		{args: "resume w1 --wait", wantOut: "Resume warehouse w1 succeed.\n", state: apitest.StateRunning},
+		{args: "status w1", wantOut: "Warehouse w1 status is Running, size is Small, readyInstance is 1, totalInstance is 1\n"},
+		{args: "suspend w1", wantOut: "Suspend warehouse w1 succeed", state: apitest.StateSuspended},
+		{args: "create w2 --size XSmall", wantOut: "warehouse w2 created, size is XSmall\n", state: apitest.StateStarting},
+		{args: "create w2", wantErr: "409 warehouse w2 already exists"},
+		{args: "delete w2", wantOut: "Warehouse w2 deleted.\n"},
+		{args: "status w2", wantErr: "404 warehouse w2 not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.args, func(t *testing.T) {
+			ios, _, stdout, _ := iostreams.Test()
+			f := &cmdutil.Factory{
+				IOStreams: ios,
+				CloudAPI: func() (api.CloudAPI, error) {
+					return api.New(
+						api.WithEndpoint(srv.URL),
+						api.WithOrg(apitest.DefaultOrg),
+						api.WithTokenSource(api.StaticToken(apitest.DefaultAPIKey)),
+					)
+				},
+			}
+			cmd := NewWarehouseCmd(f)
+			argv, err := shlex.Split(tt.args)
+			assert.NoError(t, err)
+			cmd.SetArgs(argv)
+			cmd.SetOut(stdout)
+			cmd.SetErr(stdout)
+
+			_, err = cmd.ExecuteC()
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Contains(t, stdout.String(), tt.wantOut)
+			if tt.state != "" {
+				name := argv[1]
+				assert.Equal(t, tt.state, srv.Warehouse(name))
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package whoami
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/databendcloud/bendsql/pkg/cmdutil"
+)
+
+func NewCmdWhoami(f *cmdutil.Factory) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "whoami",
+		Short: "Print the email of the logged in account",
+		Long:  "Print the email of the Databend Cloud account of the active profile",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			apiClient, err := f.CloudAPI()
+			if err != nil {
+				return errors.Wrap(err, "get api client failed")
+			}
+			account, err := apiClient.GetCurrentAccountInfo(cmd.Context())
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(f.IOStreams.Out, account.Email)
+			return nil
+		},
+	}
+
+	return cmd
+}
@@ -0,0 +1,57 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"github.com/spf13/cobra"
+
+	configDSNCmd "github.com/databendcloud/bendsql/pkg/cmd/config/dsn"
+	configEditCmd "github.com/databendcloud/bendsql/pkg/cmd/config/edit"
+	configGetCmd "github.com/databendcloud/bendsql/pkg/cmd/config/get"
+	configListCmd "github.com/databendcloud/bendsql/pkg/cmd/config/list"
+	configMigrateCmd "github.com/databendcloud/bendsql/pkg/cmd/config/migrate"
+	configPathCmd "github.com/databendcloud/bendsql/pkg/cmd/config/path"
+	configResolveCmd "github.com/databendcloud/bendsql/pkg/cmd/config/resolve"
+	configSetCmd "github.com/databendcloud/bendsql/pkg/cmd/config/set"
+	configUnsetCmd "github.com/databendcloud/bendsql/pkg/cmd/config/unset"
+	"github.com/databendcloud/bendsql/pkg/cmdutil"
+)
+
+// NewConfigCmd represents the config command
+func NewConfigCmd(f *cmdutil.Factory) *cobra.Command {
+	configCmd := &cobra.Command{
+		Use:   "config",
+		Short: "Manage configuration",
+		Long: `Manage configuration of the active profile with dotted keys. For example:
+            bendsql config list
+            bendsql config get community.host
+            bendsql config set community.options.max_rows 1000
+            bendsql config unset cloud.warehouse
+            bendsql config resolve
+            bendsql config migrate --dry-run
+            bendsql config dsn --redact
+`,
+	}
+	configCmd.AddCommand(configGetCmd.NewCmdConfigGet(f))
+	configCmd.AddCommand(configSetCmd.NewCmdConfigSet(f))
+	configCmd.AddCommand(configUnsetCmd.NewCmdConfigUnset(f))
+	configCmd.AddCommand(configListCmd.NewCmdConfigList(f))
+	configCmd.AddCommand(configEditCmd.NewCmdConfigEdit(f))
+	configCmd.AddCommand(configPathCmd.NewCmdConfigPath(f))
+	configCmd.AddCommand(configResolveCmd.NewCmdConfigResolve(f))
+	configCmd.AddCommand(configMigrateCmd.NewCmdConfigMigrate(f))
+	configCmd.AddCommand(configDSNCmd.NewCmdConfigDSN(f))
+	return configCmd
+}
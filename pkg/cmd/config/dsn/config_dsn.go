@@ -0,0 +1,63 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+
+	"github.com/MakeNowJust/heredoc"
+	"github.com/spf13/cobra"
+
+	"github.com/databendcloud/bendsql/internal/config"
+	"github.com/databendcloud/bendsql/pkg/cmdutil"
+)
+
+type dsnOptions struct {
+	Redact bool
+}
+
+func NewCmdConfigDSN(f *cmdutil.Factory) *cobra.Command {
+	opts := &dsnOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "dsn",
+		Short: "Print the DSN of the active profile",
+		Long:  "Print the DSN of the active profile with environment and flag overrides applied, for use by other tools",
+		Args:  cobra.NoArgs,
+		Example: heredoc.Doc(`
+			$ bendsql config dsn
+			$ bendsql --profile prod config dsn --redact
+		`),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := f.Config()
+			if err != nil {
+				return err
+			}
+			dsn, err := cfg.GetDSN(config.RuntimeOptions{})
+			if err != nil {
+				return err
+			}
+			if opts.Redact {
+				dsn = config.RedactDSN(dsn)
+			}
+			fmt.Fprintln(f.IOStreams.Out, dsn)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&opts.Redact, "redact", false, "Mask the password and secret options")
+
+	return cmd
+}
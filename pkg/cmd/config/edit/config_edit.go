@@ -0,0 +1,77 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+
+	"github.com/google/shlex"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/databendcloud/bendsql/internal/config"
+	"github.com/databendcloud/bendsql/pkg/cmdutil"
+)
+
+func NewCmdConfigEdit(f *cmdutil.Factory) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "edit",
+		Short: "Open the config file in an editor",
+		Long:  "Open the config file in $BENDSQL_EDITOR, $VISUAL or $EDITOR and validate it afterwards",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			args, err := shlex.Split(editor())
+			if err != nil || len(args) == 0 {
+				return errors.Errorf("invalid editor %q", editor())
+			}
+			path := config.Path()
+			if path == "" {
+				return errors.New("can not find home directory, please use --config to set the config file")
+			}
+			if config.IsEphemeral() {
+				return errors.New("can not edit the config file with --ephemeral")
+			}
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return errors.Wrap(err, "create config directory")
+			}
+			c := exec.Command(args[0], append(args[1:], path)...)
+			c.Stdin = f.IOStreams.In
+			c.Stdout = f.IOStreams.Out
+			c.Stderr = f.IOStreams.ErrOut
+			if err := c.Run(); err != nil {
+				return errors.Wrap(err, "failed to run editor")
+			}
+			_, err = f.Config()
+			return err
+		},
+	}
+
+	return cmd
+}
+
+func editor() string {
+	for _, env := range []string{"BENDSQL_EDITOR", "VISUAL", "EDITOR"} {
+		if e := os.Getenv(env); e != "" {
+			return e
+		}
+	}
+	if runtime.GOOS == "windows" {
+		return "notepad"
+	}
+	return "vi"
+}
@@ -0,0 +1,52 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+
+	"github.com/MakeNowJust/heredoc"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/databendcloud/bendsql/pkg/cmdutil"
+)
+
+func NewCmdConfigGet(f *cmdutil.Factory) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "get",
+		Short: "Print the value of a config key",
+		Long:  "Print the value of a config key, secrets are printed as stored",
+		Args:  cobra.ExactArgs(1),
+		Example: heredoc.Doc(`
+			$ bendsql config get community.host
+			$ bendsql config get cloud.warehouse
+		`),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := f.Config()
+			if err != nil {
+				return errors.Wrap(err, "failed to get config")
+			}
+			value, err := cfg.GetValue(args[0])
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(f.IOStreams.Out, value)
+			return nil
+		},
+	}
+
+	return cmd
+}
@@ -0,0 +1,51 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+
+	"github.com/MakeNowJust/heredoc"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/databendcloud/bendsql/pkg/cmdutil"
+)
+
+func NewCmdConfigList(f *cmdutil.Factory) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "Print all config keys of the active profile",
+		Long:    "Print all config keys of the active profile, secrets are masked",
+		Args:    cobra.NoArgs,
+		Example: heredoc.Doc(`
+			$ bendsql config list
+			$ bendsql --profile prod config list
+		`),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := f.Config()
+			if err != nil {
+				return errors.Wrap(err, "failed to get config")
+			}
+			for _, kv := range cfg.List() {
+				fmt.Fprintf(f.IOStreams.Out, "%s=%s\n", kv.Key, kv.Value)
+			}
+			return nil
+		},
+	}
+
+	return cmd
+}
@@ -0,0 +1,78 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+
+	"github.com/MakeNowJust/heredoc"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/databendcloud/bendsql/internal/config"
+	"github.com/databendcloud/bendsql/pkg/cmdutil"
+)
+
+type migrateOptions struct {
+	DryRun bool
+}
+
+func NewCmdConfigMigrate(f *cmdutil.Factory) *cobra.Command {
+	opts := &migrateOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Upgrade the config file to the current version",
+		Long:  "Upgrade the config file to the current version, the old file is kept as a backup copy",
+		Args:  cobra.NoArgs,
+		Example: heredoc.Doc(`
+			$ bendsql config migrate --dry-run
+			$ bendsql config migrate
+		`),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			plan, err := config.PlanMigration()
+			if err != nil {
+				return err
+			}
+			out := f.IOStreams.Out
+			if len(plan.Migrations) == 0 {
+				fmt.Fprintf(out, "Config file %s is up to date (version %d).\n", plan.Path, plan.Version)
+				return nil
+			}
+			for _, m := range plan.Migrations {
+				fmt.Fprintf(out, "version %d: %s\n", m.Version, m.Description)
+			}
+			diff, err := plan.Diff()
+			if err != nil {
+				return errors.Wrap(err, "failed to diff config file")
+			}
+			fmt.Fprintf(out, "\n%s", diff)
+			if opts.DryRun {
+				return nil
+			}
+
+			backup, err := config.Migrate()
+			if err != nil {
+				return errors.Wrap(err, "migrate config failed")
+			}
+			fmt.Fprintf(out, "\nConfig file migrated to version %d, the old file is saved as %s.\n", config.CurrentVersion, backup)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&opts.DryRun, "dry-run", false, "Show the changes without writing the config file")
+
+	return cmd
+}
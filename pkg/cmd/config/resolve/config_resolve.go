@@ -0,0 +1,69 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/MakeNowJust/heredoc"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/databendcloud/bendsql/internal/config"
+	"github.com/databendcloud/bendsql/pkg/cmdutil"
+)
+
+func NewCmdConfigResolve(f *cmdutil.Factory) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "resolve",
+		Short: "Print the effective config and where each value comes from",
+		Long: heredoc.Doc(`
+			Print the effective config and where each value comes from.
+
+			Every key of the profile can be overridden, in order of precedence, by
+			--override KEY=VALUE, by the environment variable BENDSQL_<KEY> with dots
+			replaced by underscores (e.g. BENDSQL_COMMUNITY_HOST), by the profile and
+			finally by the built-in defaults.
+		`),
+		Args: cobra.NoArgs,
+		Example: heredoc.Doc(`
+			$ BENDSQL_COMMUNITY_HOST=db.internal bendsql config resolve
+			$ bendsql --override cloud.warehouse=etl config resolve
+		`),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := f.Config()
+			if err != nil {
+				return errors.Wrap(err, "failed to get config")
+			}
+			_, resolved, err := cfg.Resolve()
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(f.IOStreams.Out, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "KEY\tVALUE\tSOURCE")
+			for _, r := range resolved {
+				source := r.Source
+				if r.Origin != "" {
+					source = fmt.Sprintf("%s (%s)", r.Source, r.Origin)
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\n", r.Key, config.MaskSecret(r.Key, r.Value), source)
+			}
+			return w.Flush()
+		},
+	}
+
+	return cmd
+}
@@ -0,0 +1,51 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"github.com/MakeNowJust/heredoc"
+	"github.com/spf13/cobra"
+
+	"github.com/databendcloud/bendsql/internal/config"
+	"github.com/databendcloud/bendsql/pkg/cmdutil"
+)
+
+func NewCmdConfigSet(f *cmdutil.Factory) *cobra.Command {
+	var ref bool
+	cmd := &cobra.Command{
+		Use:   "set",
+		Short: "Set the value of a config key",
+		Long:  "Set the value of a config key, the value is validated and secrets are saved to the credential store",
+		Args:  cobra.ExactArgs(2),
+		Example: heredoc.Doc(`
+			$ bendsql config set community.host localhost
+			$ bendsql config set community.options.max_rows 1000
+
+			# read the password from an environment variable on each connection
+			$ bendsql config set --ref community.password env:DATABEND_PASS
+		`),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return config.Update(func(cfg *config.Config) error {
+				if ref {
+					return cfg.SetSecretRef(args[0], args[1])
+				}
+				return cfg.SetValue(args[0], args[1])
+			})
+		},
+	}
+	cmd.Flags().BoolVar(&ref, "ref", false, "Set a secret to a reference resolved on each connection: env:NAME, file:PATH or cmd:COMMAND")
+
+	return cmd
+}
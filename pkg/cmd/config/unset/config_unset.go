@@ -0,0 +1,43 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"github.com/MakeNowJust/heredoc"
+	"github.com/spf13/cobra"
+
+	"github.com/databendcloud/bendsql/internal/config"
+	"github.com/databendcloud/bendsql/pkg/cmdutil"
+)
+
+func NewCmdConfigUnset(f *cmdutil.Factory) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "unset",
+		Short: "Remove a config key",
+		Long:  "Remove a config key, a table such as cloud.token is removed with all its keys",
+		Args:  cobra.ExactArgs(1),
+		Example: heredoc.Doc(`
+			$ bendsql config unset community.options.max_rows
+			$ bendsql config unset cloud.token
+		`),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return config.Update(func(cfg *config.Config) error {
+				return cfg.UnsetValue(args[0])
+			})
+		},
+	}
+
+	return cmd
+}
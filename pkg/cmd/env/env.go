@@ -0,0 +1,73 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package env
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/MakeNowJust/heredoc"
+	"github.com/spf13/cobra"
+
+	"github.com/databendcloud/bendsql/internal/config"
+	"github.com/databendcloud/bendsql/pkg/cmdutil"
+)
+
+type envOptions struct {
+	Redact bool
+}
+
+func NewCmdEnv(f *cmdutil.Factory) *cobra.Command {
+	opts := &envOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "env",
+		Short: "Print shell exports of the active connection",
+		Long: heredoc.Doc(`
+			Print shell exports of the active connection, DATABEND_DSN holds the DSN
+			of the active profile with environment and flag overrides applied.
+		`),
+		Args: cobra.NoArgs,
+		Example: heredoc.Doc(`
+			$ eval "$(bendsql env)"
+			$ bendsql --profile prod env --redact
+		`),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := f.Config()
+			if err != nil {
+				return err
+			}
+			dsn, err := cfg.GetDSN(config.RuntimeOptions{})
+			if err != nil {
+				return err
+			}
+			if opts.Redact {
+				dsn = config.RedactDSN(dsn)
+			}
+			fmt.Fprintf(f.IOStreams.Out, "export BENDSQL_PROFILE=%s\n", shellQuote(cfg.ActiveProfile()))
+			fmt.Fprintf(f.IOStreams.Out, "export DATABEND_DSN=%s\n", shellQuote(dsn))
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&opts.Redact, "redact", false, "Mask the password and secret options")
+
+	return cmd
+}
+
+// shellQuote quotes s for POSIX shells.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,124 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mockserver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/MakeNowJust/heredoc"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/databendcloud/bendsql/pkg/cmdutil"
+	"github.com/databendcloud/bendsql/pkg/mockserver"
+)
+
+type mockServerOptions struct {
+	Listen   string
+	Fixtures []string
+	Latency  time.Duration
+	PageSize int
+}
+
+func NewCmdMockServer(f *cmdutil.Factory) *cobra.Command {
+	opts := &mockServerOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "mock-server",
+		Short: "Serve canned query results for testing",
+		Long: heredoc.Doc(`
+			Serve canned query results over the /v1/query protocol of Databend, so that
+			bendsql, the databend-go driver and other clients can be tested without a
+			warehouse.
+
+			Fixtures are YAML files with a list of queries, the first one whose match
+			regular expression matches the SQL is served:
+
+			    latency: 50ms
+			    page_size: 100
+			    queries:
+			      - match: (?i)^select 1$
+			        schema: [{name: "1", type: UInt8}]
+			        rows: [["1"]]
+			      - match: (?i)from users
+			        csv: users.csv
+			      - match: (?i)from missing
+			        error: {code: 1025, message: "Unknown table 'missing'"}
+			      - match: (?i)from flaky
+			        status: 503
+
+			Rows of a csv file, relative to the fixture file, follow a header line with
+			the column names. Queries no fixture matches fail with code 1000. Queries are
+			forgotten when their final_uri is called or after query_ttl, 5m by default,
+			without a request.
+		`),
+		Args: cobra.NoArgs,
+		Example: heredoc.Doc(`
+			$ bendsql mock-server --fixtures testdata/queries.yaml
+			$ bendsql mock-server --fixtures queries.yaml --listen 127.0.0.1:9000 --page-size 10 --latency 200ms
+		`),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(opts.Fixtures) == 0 {
+				return cmdutil.FlagErrorf("at least one --fixtures file is required")
+			}
+			fixtures, err := mockserver.LoadFixtures(opts.Fixtures...)
+			if err != nil {
+				return err
+			}
+			fixtures.SetDefaults(opts.Latency, opts.PageSize)
+			handler, err := mockserver.New(fixtures)
+			if err != nil {
+				return err
+			}
+			ln, err := net.Listen("tcp", opts.Listen)
+			if err != nil {
+				return errors.Wrap(err, "failed to listen")
+			}
+			fmt.Fprintf(f.IOStreams.ErrOut, "Serving %d fixtures on http://%s, connect with:\n", len(fixtures.Queries), ln.Addr())
+			fmt.Fprintf(f.IOStreams.ErrOut, "  bendsql connect 'databend://root:@%s/default?sslmode=disable'\n", ln.Addr())
+			return serve(cmd.Context(), ln, handler)
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.Listen, "listen", "127.0.0.1:8000", "Address to listen on")
+	cmd.Flags().StringArrayVar(&opts.Fixtures, "fixtures", nil, "YAML fixture file, may be repeated")
+	cmd.Flags().DurationVar(&opts.Latency, "latency", 0, "Delay of every page of fixtures without a latency")
+	cmd.Flags().IntVar(&opts.PageSize, "page-size", 0, "Rows per page of fixtures without a page size, 0 sends all rows at once")
+
+	return cmd
+}
+
+// serve handles requests until ctx is done.
+func serve(ctx context.Context, ln net.Listener, handler http.Handler) error {
+	srv := &http.Server{Handler: handler}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+	err := srv.Serve(ln)
+	if err == http.ErrServerClosed {
+		<-done
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,74 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"fmt"
+
+	"github.com/MakeNowJust/heredoc"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/databendcloud/bendsql/internal/config"
+	"github.com/databendcloud/bendsql/pkg/cmdutil"
+)
+
+func NewCmdProfileList(f *cmdutil.Factory) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ls",
+		Short: "show profile list",
+		Long:  "show profile list, the active profile is marked with *",
+		Args:  cobra.NoArgs,
+		Example: heredoc.Doc(`
+			# show profile list
+			$ bendsql profile ls
+		`),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := f.Config()
+			if err != nil {
+				return errors.Wrap(err, "failed to get config")
+			}
+			names := cfg.ProfileNames()
+			if len(names) == 0 {
+				return cmdutil.NewNoResultsError("no profiles found, please use `bendsql connect` or `bendsql cloud login` first")
+			}
+			active := cfg.ActiveProfile()
+			for _, name := range names {
+				mark := " "
+				if name == active {
+					mark = "*"
+				}
+				fmt.Fprintf(f.IOStreams.Out, "%s %s\t%s\n", mark, name, describe(cfg.Profiles[name]))
+			}
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+func describe(p *config.Profile) string {
+	switch p.Target {
+	case config.TARGET_COMMUNITY:
+		if p.Community != nil {
+			return fmt.Sprintf("community %s@%s:%d", p.Community.User, p.Community.Host, p.Community.Port)
+		}
+	case config.TARGET_CLOUD:
+		if p.Cloud != nil {
+			return fmt.Sprintf("cloud %s/%s@%s", p.Cloud.Org, p.Cloud.Warehouse, p.Cloud.Endpoint)
+		}
+	}
+	return p.Target
+}
@@ -0,0 +1,46 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"github.com/spf13/cobra"
+
+	profileListCmd "github.com/databendcloud/bendsql/pkg/cmd/profile/ls"
+	profileRenameCmd "github.com/databendcloud/bendsql/pkg/cmd/profile/rename"
+	profileRemoveCmd "github.com/databendcloud/bendsql/pkg/cmd/profile/rm"
+	profileUseCmd "github.com/databendcloud/bendsql/pkg/cmd/profile/use"
+	"github.com/databendcloud/bendsql/pkg/cmdutil"
+)
+
+// NewProfileCmd represents the profile command
+func NewProfileCmd(f *cmdutil.Factory) *cobra.Command {
+	profileCmd := &cobra.Command{
+		Use:   "profile",
+		Short: "Manage connection profiles",
+		Long: `Manage named connection profiles stored in config.toml. For example:
+            bendsql profile ls
+            bendsql profile use staging
+            bendsql --profile prod-cn query
+`,
+		Annotations: map[string]string{
+			"IsCore": "true",
+		},
+	}
+	profileCmd.AddCommand(profileListCmd.NewCmdProfileList(f))
+	profileCmd.AddCommand(profileUseCmd.NewCmdProfileUse(f))
+	profileCmd.AddCommand(profileRenameCmd.NewCmdProfileRename(f))
+	profileCmd.AddCommand(profileRemoveCmd.NewCmdProfileRemove(f))
+	return profileCmd
+}
@@ -0,0 +1,51 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"fmt"
+
+	"github.com/MakeNowJust/heredoc"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/databendcloud/bendsql/internal/config"
+	"github.com/databendcloud/bendsql/pkg/cmdutil"
+)
+
+func NewCmdProfileRemove(f *cmdutil.Factory) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rm",
+		Short: "Delete a profile",
+		Long:  "Delete a profile and the connection settings stored in it",
+		Args:  cobra.ExactArgs(1),
+		Example: heredoc.Doc(`
+			# delete a profile
+			$ bendsql profile rm [PROFILE]
+		`),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := config.Update(func(cfg *config.Config) error {
+				return cfg.RemoveProfile(args[0])
+			})
+			if err != nil {
+				return errors.Wrapf(err, "delete profile %s failed", args[0])
+			}
+			fmt.Fprintf(f.IOStreams.Out, "Profile %s deleted.\n", args[0])
+			return nil
+		},
+	}
+
+	return cmd
+}
@@ -0,0 +1,50 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"fmt"
+
+	"github.com/MakeNowJust/heredoc"
+	"github.com/spf13/cobra"
+
+	"github.com/databendcloud/bendsql/internal/config"
+	"github.com/databendcloud/bendsql/pkg/cmdutil"
+)
+
+func NewCmdProfileUse(f *cmdutil.Factory) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "use",
+		Short: "select the default profile",
+		Long:  "select the profile used when neither --profile nor BENDSQL_PROFILE is given",
+		Args:  cobra.ExactArgs(1),
+		Example: heredoc.Doc(`
+			# select the default profile
+			$ bendsql profile use [PROFILE]
+		`),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := config.Update(func(cfg *config.Config) error {
+				return cfg.UseProfile(args[0])
+			})
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(f.IOStreams.Out, "Now using profile <%s>\n", args[0])
+			return nil
+		},
+	}
+
+	return cmd
+}
@@ -15,18 +15,21 @@
 package query
 
 import (
-	"context"
+	"database/sql"
+	"io"
 	"os"
 	"os/user"
 	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	"github.com/xo/dburl"
 	"github.com/xo/usql/drivers"
 	"github.com/xo/usql/env"
 	"github.com/xo/usql/handler"
 	"github.com/xo/usql/rline"
 
+	"github.com/databendcloud/bendsql/api"
 	"github.com/databendcloud/bendsql/internal/config"
 	"github.com/databendcloud/bendsql/pkg/cmdutil"
 )
@@ -57,7 +60,7 @@ func NewCmdQuery(f *cmdutil.Factory) *cobra.Command {
 			"IsCore": "true",
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			cfg, err := config.GetConfig()
+			cfg, err := f.Config()
 			if err != nil {
 				return err
 			}
@@ -66,9 +69,17 @@ func NewCmdQuery(f *cmdutil.Factory) *cobra.Command {
 				return errors.Wrap(err, "failed to get dsn")
 			}
 
-			// register databend driver
+			// register databend driver, every connection is opened with a fresh
+			// dsn so that cloud tokens are renewed in long sessions
 			drivers.Register("databend", drivers.Driver{
 				UseColumnTypes: true,
+				Open: func(*dburl.URL, func() io.Writer, func() io.Writer) (func(string, string) (*sql.DB, error), error) {
+					return func(string, string) (*sql.DB, error) {
+						return api.OpenDB(func() (string, error) {
+							return cfg.GetDSN(opts.ConnOpts)
+						}), nil
+					}, nil
+				},
 			})
 
 			// load current user
@@ -118,7 +129,7 @@ func NewCmdQuery(f *cmdutil.Factory) *cobra.Command {
 			// create handler
 			h := handler.New(l, cur, wd, true)
 			// open dsn
-			if err = h.Open(context.Background(), dsn); err != nil {
+			if err = h.Open(cmd.Context(), dsn); err != nil {
 				return errors.Wrap(err, "failed to open dsn")
 			}
 			return h.Run()
@@ -30,6 +30,47 @@ var HelpTopics = map[string]map[string]string{
 		"long": heredoc.Doc(`
 			BENDSQL_CONFIG_DIR: the directory where bendsql will store configuration files. Default:
 			"$HOME/.config/bendsql".
+
+			BENDSQL_PROFILE: the connection profile to use when --profile is not given, instead of
+			the current profile.
+
+			BENDSQL_EPHEMERAL: set to "1" to never write the config file or the credential vault,
+			like --ephemeral.
+
+			BENDSQL_VAULT_PASSPHRASE: the passphrase of the credential vault, so that bendsql does
+			not prompt for it.
+
+			BENDSQL_TOKEN: a Databend Cloud access token, API key or personal access token used
+			for every request instead of the token of the profile. It is never saved or refreshed.
+
+			BENDSQL_PROXY: the proxy for Databend Cloud API requests, an http, https, socks5 or
+			socks5h URL. It overrides HTTPS_PROXY and HTTP_PROXY, --proxy takes precedence.
+
+			BENDSQL_DEBUG: set to "api" to log Databend Cloud API requests and responses to stderr
+			with secrets redacted, like --debug-http.
+		`),
+	},
+	"exit-codes": {
+		"short": "Exit codes of bendsql",
+		"long": heredoc.Doc(`
+			bendsql exits with one of the following codes, scripts can rely on them:
+
+			0: success
+			1: any other error
+			2: cancelled, e.g. with Ctrl-C
+			4: not logged in or not allowed, login again with bendsql cloud login
+			5: the warehouse, organization or other resource was not found
+			6: a quota or rate limit of Databend Cloud was exceeded
+			7: the warehouse is suspended
+			8: the query failed, the Databend error code is in --error-format json
+			9: Databend Cloud could not be reached
+
+			With --error-format json, errors are printed to stderr as a single line such as:
+
+			{"error":{"kind":"auth","message":"401 ...","hint":"...","exit_code":4,"status":401}}
+
+			kind is one of auth, not_found, quota, warehouse_suspended, query, network, usage,
+			cancel and error.
 		`),
 	},
 	"reference": {
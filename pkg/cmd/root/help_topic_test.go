@@ -91,3 +91,17 @@ func TestNewHelpTopic(t *testing.T) {
 		})
 	}
 }
+
+func TestEnvironmentHelpTopic(t *testing.T) {
+	for _, env := range []string{
+		"BENDSQL_CONFIG_DIR",
+		"BENDSQL_PROFILE",
+		"BENDSQL_EPHEMERAL",
+		"BENDSQL_VAULT_PASSPHRASE",
+		"BENDSQL_TOKEN",
+		"BENDSQL_PROXY",
+		"BENDSQL_DEBUG",
+	} {
+		assert.Contains(t, HelpTopics["environment"]["long"], env+":")
+	}
+}
@@ -15,13 +15,23 @@
 package root
 
 import (
+	"os"
+	"strings"
+	"time"
+
 	"github.com/MakeNowJust/heredoc"
 	"github.com/spf13/cobra"
 
+	"github.com/databendcloud/bendsql/api"
+	"github.com/databendcloud/bendsql/internal/config"
 	benchmarkCmd "github.com/databendcloud/bendsql/pkg/cmd/benchmark"
 	cloudCmd "github.com/databendcloud/bendsql/pkg/cmd/cloud"
 	completionCmd "github.com/databendcloud/bendsql/pkg/cmd/completion"
+	configCmd "github.com/databendcloud/bendsql/pkg/cmd/config"
 	connectCmd "github.com/databendcloud/bendsql/pkg/cmd/connect"
+	envCmd "github.com/databendcloud/bendsql/pkg/cmd/env"
+	mockServerCmd "github.com/databendcloud/bendsql/pkg/cmd/mockserver"
+	profileCmd "github.com/databendcloud/bendsql/pkg/cmd/profile"
 	queryCmd "github.com/databendcloud/bendsql/pkg/cmd/query"
 	versionCmd "github.com/databendcloud/bendsql/pkg/cmd/version"
 	"github.com/databendcloud/bendsql/pkg/cmdutil"
@@ -30,6 +40,20 @@ import (
 // rootCmd represents the base command when called without any subcommands
 
 func NewCmdRoot(f *cmdutil.Factory, version, buildDate string) *cobra.Command {
+	var (
+		profile    string
+		configPath string
+		ephemeral  bool
+		overrides  []string
+		timeout    time.Duration
+		proxy      string
+		debugHTTP  bool
+		harPath    string
+		har        *api.HARRecorder
+		retries    uint
+		retryLimit time.Duration
+		errFormat  string
+	)
 	cmd := &cobra.Command{
 		Use:   "bendsql <command> <subcommand> [flags]",
 		Short: "Dababend CLI",
@@ -45,12 +69,63 @@ func NewCmdRoot(f *cmdutil.Factory, version, buildDate string) *cobra.Command {
 		Annotations: map[string]string{
 			"versionInfo": versionCmd.Format(version, buildDate),
 		},
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if errFormat != "text" && errFormat != "json" {
+				return cmdutil.FlagErrorf("invalid --error-format %q, expected text or json", errFormat)
+			}
+			config.SetPath(configPath)
+			config.SetEphemeral(ephemeral || os.Getenv("BENDSQL_EPHEMERAL") == "1")
+			config.SetProfile(profile)
+			values := make(map[string]string, len(overrides))
+			for _, o := range overrides {
+				kv := strings.SplitN(o, "=", 2)
+				if len(kv) != 2 || kv[0] == "" {
+					return cmdutil.FlagErrorf("invalid --override %q, expected KEY=VALUE", o)
+				}
+				values[kv[0]] = kv[1]
+			}
+			config.SetOverrides(values)
+			if proxy == "" {
+				proxy = os.Getenv("BENDSQL_PROXY")
+			}
+			opts := api.TransportOptions{Timeout: timeout, Proxy: proxy}
+			if debugHTTP || debugAPI(os.Getenv("BENDSQL_DEBUG")) {
+				opts.Trace = f.IOStreams.ErrOut
+			}
+			if harPath != "" {
+				har = api.NewHARRecorder(harPath)
+				opts.HAR = har
+			}
+			err := api.SetTransportOptions(opts)
+			if err != nil {
+				return cmdutil.FlagErrorWrap(err)
+			}
+			api.SetRetryPolicy(api.RetryPolicy{Attempts: retries, MaxElapsed: retryLimit})
+			return nil
+		},
+		PersistentPostRunE: func(cmd *cobra.Command, args []string) error {
+			if har != nil {
+				return har.Close()
+			}
+			return nil
+		},
 	}
 
 	cmd.SetErr(f.IOStreams.ErrOut) // just let it default to os.Stderr instead
 
 	cmd.Flags().Bool("version", false, "Show bendsql version")
 	cmd.PersistentFlags().Bool("help", false, "Show help for command")
+	cmd.PersistentFlags().StringVar(&configPath, "config", "", "Path of the config file, overrides BENDSQL_CONFIG")
+	cmd.PersistentFlags().BoolVar(&ephemeral, "ephemeral", false, "Never write the config file or the credential vault, also set by BENDSQL_EPHEMERAL=1")
+	cmd.PersistentFlags().StringVar(&profile, "profile", "", "Use the named connection profile, overrides BENDSQL_PROFILE")
+	cmd.PersistentFlags().StringArrayVar(&overrides, "override", nil, "Override a config key of the profile for this command, e.g. community.host=localhost")
+	cmd.PersistentFlags().DurationVar(&timeout, "http-timeout", api.DefaultTimeout, "Timeout of Databend Cloud API requests, 0 to wait forever")
+	cmd.PersistentFlags().StringVar(&proxy, "proxy", "", "Proxy for Databend Cloud API requests: http, https, socks5 or socks5h URL, also set by BENDSQL_PROXY")
+	cmd.PersistentFlags().UintVar(&retries, "retry-attempts", 0, "Maximum attempts of failed Databend Cloud API requests, 1 disables retries, overrides retry.attempts of the config")
+	cmd.PersistentFlags().DurationVar(&retryLimit, "retry-max-elapsed", 0, "Stop retrying Databend Cloud API requests after this long, overrides retry.max_elapsed of the config")
+	cmd.PersistentFlags().StringVar(&errFormat, "error-format", "text", "Print errors as text or json for scripts, see bendsql help exit-codes")
+	cmd.PersistentFlags().BoolVar(&debugHTTP, "debug-http", false, "Log Databend Cloud API requests and responses with secrets redacted, also set by BENDSQL_DEBUG=api")
+	cmd.PersistentFlags().StringVar(&harPath, "har", "", "Save Databend Cloud API requests and responses with secrets redacted to a HAR `file`")
 	cmd.SetHelpFunc(func(c *cobra.Command, args []string) {
 		rootHelpFunc(f, c, args)
 	})
@@ -66,5 +141,27 @@ func NewCmdRoot(f *cmdutil.Factory, version, buildDate string) *cobra.Command {
 	cmd.AddCommand(connectCmd.NewCmdConnect(f))
 	cmd.AddCommand(queryCmd.NewCmdQuery(f))
 	cmd.AddCommand(benchmarkCmd.NewCmdBenchmark(f))
+	cmd.AddCommand(profileCmd.NewProfileCmd(f))
+	cmd.AddCommand(configCmd.NewConfigCmd(f))
+	cmd.AddCommand(envCmd.NewCmdEnv(f))
+	cmd.AddCommand(mockServerCmd.NewCmdMockServer(f))
+
+	// Help topics
+	for topic, params := range HelpTopics {
+		if params["long"] != "" {
+			cmd.AddCommand(NewHelpTopic(f.IOStreams, topic))
+		}
+	}
 	return cmd
 }
+
+// debugAPI reports whether the comma separated BENDSQL_DEBUG value enables
+// tracing of API requests.
+func debugAPI(value string) bool {
+	for _, v := range strings.Split(value, ",") {
+		if strings.TrimSpace(v) == "api" {
+			return true
+		}
+	}
+	return false
+}
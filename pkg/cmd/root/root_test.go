@@ -0,0 +1,43 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package root
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/databendcloud/bendsql/pkg/cmdutil"
+	"github.com/databendcloud/bendsql/pkg/iostreams"
+)
+
+func TestResumeTimeoutFlags(t *testing.T) {
+	ios, _, _, _ := iostreams.Test()
+	root := NewCmdRoot(&cmdutil.Factory{IOStreams: ios}, "", "")
+	resume, args, err := root.Find([]string{"cloud", "warehouse", "resume"})
+	assert.NoError(t, err)
+	assert.Empty(t, args)
+
+	// --timeout of resume and the global --http-timeout do not shadow each other
+	assert.NoError(t, resume.ParseFlags([]string{"--wait", "--timeout", "10m", "--http-timeout", "5m"}))
+	wait, err := resume.Flags().GetDuration("timeout")
+	assert.NoError(t, err)
+	assert.Equal(t, 10*time.Minute, wait)
+	request, err := resume.InheritedFlags().GetDuration("http-timeout")
+	assert.NoError(t, err)
+	assert.Equal(t, 5*time.Minute, request)
+	assert.Nil(t, resume.InheritedFlags().Lookup("timeout"))
+}
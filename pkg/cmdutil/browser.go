@@ -0,0 +1,56 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmdutil
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+
+	"github.com/google/shlex"
+	"github.com/pkg/errors"
+)
+
+// OpenBrowser opens url in $BENDSQL_BROWSER, $BROWSER or the default browser.
+func OpenBrowser(url string) error {
+	var args []string
+	for _, env := range []string{"BENDSQL_BROWSER", "BROWSER"} {
+		if b := os.Getenv(env); b != "" {
+			a, err := shlex.Split(b)
+			if err != nil || len(a) == 0 {
+				return errors.Errorf("invalid browser %q in %s", b, env)
+			}
+			args = a
+			break
+		}
+	}
+	if args == nil {
+		switch runtime.GOOS {
+		case "darwin":
+			args = []string{"open"}
+		case "windows":
+			args = []string{"rundll32", "url.dll,FileProtocolHandler"}
+		default:
+			args = []string{"xdg-open"}
+		}
+	}
+	cmd := exec.Command(args[0], append(args[1:], url)...)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	// don't leave a zombie behind, the browser may keep running
+	go func() { _ = cmd.Wait() }()
+	return nil
+}
@@ -15,10 +15,13 @@
 package cmdutil
 
 import (
+	"context"
 	"errors"
 	"fmt"
 
 	"github.com/AlecAivazis/survey/v2/terminal"
+
+	"github.com/databendcloud/bendsql/api"
 )
 
 // FlagErrorf returns a new FlagError that wraps an error produced by
@@ -52,7 +55,7 @@ var SilentError = errors.New("SilentError")
 var CancelError = errors.New("CancelError")
 
 func IsUserCancellation(err error) bool {
-	return errors.Is(err, CancelError) || errors.Is(err, terminal.InterruptErr)
+	return errors.Is(err, CancelError) || errors.Is(err, terminal.InterruptErr) || errors.Is(err, context.Canceled)
 }
 
 func MutuallyExclusive(message string, conditions ...bool) error {
@@ -79,3 +82,76 @@ func (e NoResultsError) Error() string {
 func NewNoResultsError(message string) NoResultsError {
 	return NoResultsError{message: message}
 }
+
+// ExitCode is the exit status of bendsql, the values are documented in
+// `bendsql help exit-codes` and must not change.
+type ExitCode int
+
+const (
+	ExitOK                 ExitCode = 0
+	ExitError              ExitCode = 1
+	ExitCancel             ExitCode = 2
+	ExitAuth               ExitCode = 4
+	ExitNotFound           ExitCode = 5
+	ExitQuota              ExitCode = 6
+	ExitWarehouseSuspended ExitCode = 7
+	ExitQuery              ExitCode = 8
+	ExitNetwork            ExitCode = 9
+)
+
+var exitCodes = map[api.ErrorKind]ExitCode{
+	api.ErrorAuth:               ExitAuth,
+	api.ErrorNotFound:           ExitNotFound,
+	api.ErrorQuota:              ExitQuota,
+	api.ErrorWarehouseSuspended: ExitWarehouseSuspended,
+	api.ErrorQuery:              ExitQuery,
+	api.ErrorNetwork:            ExitNetwork,
+}
+
+// ExitCodeOf returns the exit status of a command failing with err.
+func ExitCodeOf(err error) ExitCode {
+	if err == nil {
+		return ExitOK
+	}
+	if IsUserCancellation(err) {
+		return ExitCancel
+	}
+	if e := api.AsError(err); e != nil {
+		return exitCodes[e.Kind]
+	}
+	return ExitError
+}
+
+// ErrorJSON is how --error-format json prints an error.
+type ErrorJSON struct {
+	// Kind is one of the api.ErrorKind values, usage for invalid flags or
+	// arguments, cancel or error for all other errors.
+	Kind     string `json:"kind"`
+	Message  string `json:"message"`
+	Hint     string `json:"hint,omitempty"`
+	ExitCode int    `json:"exit_code"`
+	// Status is the HTTP status of failed Databend Cloud requests.
+	Status int `json:"status,omitempty"`
+	// Code is the Databend error code of failed queries.
+	Code int `json:"code,omitempty"`
+}
+
+func NewErrorJSON(err error) ErrorJSON {
+	e := ErrorJSON{
+		Kind:     "error",
+		Message:  err.Error(),
+		ExitCode: int(ExitCodeOf(err)),
+	}
+	var flagError *FlagError
+	if apiErr := api.AsError(err); apiErr != nil && !IsUserCancellation(err) {
+		e.Kind = string(apiErr.Kind)
+		e.Hint = apiErr.Hint
+		e.Status = apiErr.StatusCode
+		e.Code = apiErr.Code
+	} else if IsUserCancellation(err) {
+		e.Kind = "cancel"
+	} else if errors.As(err, &flagError) {
+		e.Kind = "usage"
+	}
+	return e
+}
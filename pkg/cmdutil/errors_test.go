@@ -0,0 +1,47 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmdutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	dc "github.com/databendcloud/databend-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExitCodeOf(t *testing.T) {
+	authErr := fmt.Errorf("list warehouses failed: %w", dc.NewAPIError("please use `bendsql cloud login` to login your account.", http.StatusUnauthorized, nil))
+	queryErr := fmt.Errorf("query failed: %w", &dc.QueryError{Code: 1025, Message: "Unknown table t"})
+
+	assert.Equal(t, ExitOK, ExitCodeOf(nil))
+	assert.Equal(t, ExitError, ExitCodeOf(errors.New("boom")))
+	assert.Equal(t, ExitCancel, ExitCodeOf(fmt.Errorf("query: %w", context.Canceled)))
+	assert.Equal(t, ExitAuth, ExitCodeOf(authErr))
+	assert.Equal(t, ExitQuery, ExitCodeOf(queryErr))
+
+	assert.Equal(t, ErrorJSON{
+		Kind:     "auth",
+		Message:  authErr.Error(),
+		Hint:     "please use `bendsql cloud login` to login your account.",
+		ExitCode: 4,
+		Status:   http.StatusUnauthorized,
+	}, NewErrorJSON(authErr))
+	assert.Equal(t, ErrorJSON{Kind: "query", Message: queryErr.Error(), ExitCode: 8, Code: 1025}, NewErrorJSON(queryErr))
+	assert.Equal(t, ErrorJSON{Kind: "usage", Message: "invalid flag", ExitCode: 1}, NewErrorJSON(FlagErrorf("invalid flag")))
+}
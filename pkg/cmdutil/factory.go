@@ -15,16 +15,31 @@
 package cmdutil
 
 import (
+	"context"
+	"errors"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/AlecAivazis/survey/v2"
+
+	"github.com/databendcloud/bendsql/api"
+	"github.com/databendcloud/bendsql/internal/config"
 	"github.com/databendcloud/bendsql/pkg/iostreams"
+	"github.com/databendcloud/bendsql/pkg/prompt"
 )
 
 type Factory struct {
 	IOStreams      *iostreams.IOStreams
 	ExecutableName string
+
+	// Config loads config.toml on first use, nothing is read or created
+	// for commands that never call it.
+	Config    func() (*config.Config, error)
+	APIClient func() (*api.Client, error)
+	// CloudAPI is the API client of commands that do not change the
+	// session saved in config.toml, tests replace it with a fake.
+	CloudAPI func() (api.CloudAPI, error)
 }
 
 func NewFactory() *Factory {
@@ -32,9 +47,81 @@ func NewFactory() *Factory {
 		ExecutableName: "bendsql",
 		IOStreams:      iostreams.System(),
 	}
+	f.Config = configFunc()
+	f.APIClient = apiClientFunc(f)
+	f.CloudAPI = func() (api.CloudAPI, error) {
+		apiClient, err := f.APIClient()
+		if err != nil {
+			return nil, err
+		}
+		return apiClient, nil
+	}
+	config.SetPassphraseFunc(vaultPassphrasePrompt(f.IOStreams))
+	config.SetTokenRefreshFunc(func() (*config.Token, error) {
+		apiClient, err := f.APIClient()
+		if err != nil {
+			return nil, err
+		}
+		// GetDSN has no context, a renewal is bounded by the request timeout
+		return apiClient.FreshToken(context.Background())
+	})
 	return f
 }
 
+func configFunc() func() (*config.Config, error) {
+	var cachedConfig *config.Config
+	var configError error
+	return func() (*config.Config, error) {
+		if cachedConfig != nil || configError != nil {
+			return cachedConfig, configError
+		}
+		cachedConfig, configError = config.GetConfig()
+		return cachedConfig, configError
+	}
+}
+
+func apiClientFunc(f *Factory) func() (*api.Client, error) {
+	return func() (*api.Client, error) {
+		cfg, err := f.Config()
+		if err != nil {
+			return nil, err
+		}
+		return api.NewClient(cfg)
+	}
+}
+
+// vaultPassphrasePrompt asks for the credential vault passphrase on the terminal.
+func vaultPassphrasePrompt(io *iostreams.IOStreams) func(create bool) (string, error) {
+	return func(create bool) (string, error) {
+		if !io.CanPrompt() {
+			return "", errors.New("please set BENDSQL_VAULT_PASSPHRASE to unlock the credential vault")
+		}
+		message := "Enter the passphrase of your credential vault:"
+		if create {
+			message = "Choose a passphrase for your new credential vault:"
+		}
+		var passphrase string
+		err := prompt.SurveyAskOne(&survey.Password{
+			Message: message,
+		}, &passphrase, survey.WithValidator(survey.Required))
+		if err != nil || !create {
+			return passphrase, err
+		}
+
+		var confirm string
+		err = prompt.SurveyAskOne(&survey.Password{
+			Message: "Repeat the passphrase:",
+		}, &confirm)
+		if err != nil {
+			return "", err
+		}
+		if confirm != passphrase {
+			return "", errors.New("passphrases do not match")
+		}
+		return passphrase, nil
+	}
+}
+
 // Executable is the path to the currently invoked binary
 func (f *Factory) Executable() string {
 	if !strings.ContainsRune(f.ExecutableName, os.PathSeparator) {
@@ -0,0 +1,174 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mockserver
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Column is a column of a canned result, Type is a Databend type such as
+// UInt64, Nullable(String) or Decimal(10, 2).
+type Column struct {
+	Name string `yaml:"name"`
+	Type string `yaml:"type"`
+}
+
+// QueryError is sent instead of a result, as Databend reports failed
+// queries.
+type QueryError struct {
+	Code    int    `yaml:"code"`
+	Message string `yaml:"message"`
+}
+
+// Fixture is the canned response to queries matching the regular
+// expression Match.
+type Fixture struct {
+	Match  string     `yaml:"match"`
+	Schema []Column   `yaml:"schema"`
+	Rows   [][]string `yaml:"rows"`
+	// CSV is a file with a header line holding the rows, relative to the
+	// fixture file. Columns missing from Schema are Strings.
+	CSV string `yaml:"csv"`
+	// Latency is waited before every page, it overrides the server's.
+	Latency time.Duration `yaml:"latency"`
+	// PageSize is the number of rows per page, it overrides the server's.
+	PageSize int `yaml:"page_size"`
+	// Error makes matching queries fail.
+	Error *QueryError `yaml:"error"`
+	// Status makes matching queries fail with this HTTP status, e.g. 503.
+	Status int `yaml:"status"`
+
+	re *regexp.Regexp
+}
+
+// Fixtures is the content of a fixture file, the first fixture matching a
+// query is served.
+type Fixtures struct {
+	// Latency and PageSize apply to fixtures without their own.
+	Latency  time.Duration `yaml:"latency"`
+	PageSize int           `yaml:"page_size"`
+	// QueryTTL is how long a query is kept after its last request unless
+	// its final_uri is called, DefaultQueryTTL if zero.
+	QueryTTL time.Duration `yaml:"query_ttl"`
+	Queries  []*Fixture    `yaml:"queries"`
+}
+
+// LoadFixtures reads YAML fixture files, their queries are matched in the
+// order of the files.
+func LoadFixtures(paths ...string) (*Fixtures, error) {
+	all := &Fixtures{}
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read fixtures")
+		}
+		fixtures, err := ParseFixtures(content, filepath.Dir(path))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid fixtures in %s", path)
+		}
+		all.Queries = append(all.Queries, fixtures.Queries...)
+		if fixtures.QueryTTL > 0 {
+			all.QueryTTL = fixtures.QueryTTL
+		}
+	}
+	return all, nil
+}
+
+// ParseFixtures parses YAML fixtures, CSV files are relative to dir.
+func ParseFixtures(content []byte, dir string) (*Fixtures, error) {
+	var fixtures Fixtures
+	if err := yaml.Unmarshal(content, &fixtures); err != nil {
+		return nil, err
+	}
+	fixtures.SetDefaults(fixtures.Latency, fixtures.PageSize)
+	for i, f := range fixtures.Queries {
+		if f.CSV != "" {
+			if !filepath.IsAbs(f.CSV) {
+				f.CSV = filepath.Join(dir, f.CSV)
+			}
+			if err := f.loadCSV(); err != nil {
+				return nil, errors.Wrapf(err, "query %d", i+1)
+			}
+		}
+		if err := f.compile(); err != nil {
+			return nil, errors.Wrapf(err, "query %d", i+1)
+		}
+	}
+	return &fixtures, nil
+}
+
+// SetDefaults sets the latency and page size of fixtures without their own.
+func (fs *Fixtures) SetDefaults(latency time.Duration, pageSize int) {
+	for _, f := range fs.Queries {
+		if f.Latency == 0 {
+			f.Latency = latency
+		}
+		if f.PageSize == 0 {
+			f.PageSize = pageSize
+		}
+	}
+}
+
+func (f *Fixture) compile() error {
+	if f.Match == "" {
+		return errors.New("match is required")
+	}
+	re, err := regexp.Compile(f.Match)
+	if err != nil {
+		return errors.Wrapf(err, "invalid match %q", f.Match)
+	}
+	f.re = re
+	for _, row := range f.Rows {
+		if len(row) != len(f.Schema) {
+			return errors.Errorf("row %v has %d values, the schema has %d columns", row, len(row), len(f.Schema))
+		}
+	}
+	return nil
+}
+
+func (f *Fixture) loadCSV() error {
+	file, err := os.Open(f.CSV)
+	if err != nil {
+		return errors.Wrap(err, "failed to read csv")
+	}
+	defer file.Close()
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return errors.Wrapf(err, "invalid csv %s", f.CSV)
+	}
+	if len(records) == 0 {
+		return errors.Errorf("csv %s has no header", f.CSV)
+	}
+	for i, name := range records[0] {
+		if i < len(f.Schema) {
+			f.Schema[i].Name = name
+		} else {
+			f.Schema = append(f.Schema, Column{Name: name, Type: "String"})
+		}
+	}
+	f.Rows = append(f.Rows, records[1:]...)
+	return nil
+}
+
+func (f *Fixture) matches(sql string) bool {
+	return f.re.MatchString(sql)
+}
@@ -0,0 +1,312 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mockserver serves canned query results over the /v1/query
+// protocol of Databend, for testing clients without a warehouse.
+package mockserver
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	dc "github.com/databendcloud/databend-go"
+	"github.com/pkg/errors"
+)
+
+const (
+	// NoFixtureCode is the error code of queries no fixture matches.
+	NoFixtureCode = 1000
+	// DefaultQueryTTL is how long abandoned queries are kept by default.
+	DefaultQueryTTL = 5 * time.Minute
+)
+
+type query struct {
+	fixture *Fixture
+	schema  []dc.DataField
+	pages   [][][]string
+	// done is set once the last page was sent, the query is kept until its
+	// final_uri is called so that the last page can be fetched again
+	done    bool
+	expires time.Time
+}
+
+// Server is an http.Handler answering queries from fixtures. A result is
+// split into pages of the fixture's page size, the first one is sent with
+// the response to POST /v1/query and the others are fetched from the
+// next_uri of the previous page. Queries are kept until their final_uri is
+// called or they were not requested for the query TTL.
+type Server struct {
+	fixtures *Fixtures
+	ttl      time.Duration
+
+	mu      sync.Mutex
+	seq     int
+	queries map[string]*query
+	log     []string
+}
+
+// New returns a Server answering queries from fixtures, which may also be
+// built in code rather than loaded.
+func New(fixtures *Fixtures) (*Server, error) {
+	for i, f := range fixtures.Queries {
+		if f.re == nil {
+			if err := f.compile(); err != nil {
+				return nil, errors.Wrapf(err, "query %d", i+1)
+			}
+		}
+	}
+	ttl := fixtures.QueryTTL
+	if ttl <= 0 {
+		ttl = DefaultQueryTTL
+	}
+	return &Server{
+		fixtures: fixtures,
+		ttl:      ttl,
+		queries:  make(map[string]*query),
+	}, nil
+}
+
+// Queries returns the SQL of the queries received so far.
+func (s *Server) Queries() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.log...)
+}
+
+// Running returns the number of queries whose pages are not all fetched,
+// queries abandoned for longer than the query TTL are not counted.
+func (s *Server) Running() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.evict(time.Now())
+	running := 0
+	for _, q := range s.queries {
+		if !q.done {
+			running++
+		}
+	}
+	return running
+}
+
+// evict forgets the queries that were not requested within the query TTL,
+// s.mu must be held.
+func (s *Server) evict(now time.Time) {
+	for id, q := range s.queries {
+		if now.After(q.expires) {
+			delete(s.queries, id)
+		}
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	switch {
+	case path == "/v1/query" && r.Method == "POST":
+		s.startQuery(w, r)
+	case strings.HasPrefix(path, "/v1/query/") && r.Method == "GET":
+		parts := strings.Split(strings.TrimPrefix(path, "/v1/query/"), "/")
+		switch {
+		case len(parts) == 3 && parts[1] == "page":
+			page, err := strconv.Atoi(parts[2])
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "BadRequest", "invalid page "+parts[2])
+				return
+			}
+			s.queryPage(w, r, parts[0], page)
+		case len(parts) == 2 && (parts[1] == "final" || parts[1] == "kill"):
+			s.finishQuery(w, r, parts[0])
+		default:
+			writeError(w, http.StatusNotFound, "NotFound", "no route for "+r.Method+" "+path)
+		}
+	default:
+		writeError(w, http.StatusNotFound, "NotFound", "no route for "+r.Method+" "+path)
+	}
+}
+
+func (s *Server) startQuery(w http.ResponseWriter, r *http.Request) {
+	var req dc.QueryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "BadRequest", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	s.seq++
+	id := fmt.Sprintf("mock-%d", s.seq)
+	s.log = append(s.log, req.SQL)
+	s.mu.Unlock()
+
+	fixture := s.match(req.SQL)
+	if fixture == nil {
+		writeJSON(w, r, dc.QueryResponse{
+			Id:    id,
+			State: "Failed",
+			Error: &dc.QueryError{Code: NoFixtureCode, Message: "no fixture matches query: " + req.SQL},
+		})
+		return
+	}
+	if !wait(r, fixture.Latency) {
+		return
+	}
+	if fixture.Status != 0 {
+		writeError(w, fixture.Status, "MockError", http.StatusText(fixture.Status))
+		return
+	}
+	if fixture.Error != nil {
+		writeJSON(w, r, dc.QueryResponse{
+			Id:    id,
+			State: "Failed",
+			Error: &dc.QueryError{Code: fixture.Error.Code, Message: fixture.Error.Message},
+		})
+		return
+	}
+
+	q := &query{fixture: fixture, pages: paginate(fixture.Rows, fixture.PageSize)}
+	for _, c := range fixture.Schema {
+		q.schema = append(q.schema, dc.DataField{Name: c.Name, Type: c.Type})
+	}
+	if len(q.pages) > 1 {
+		s.mu.Lock()
+		now := time.Now()
+		s.evict(now)
+		q.expires = now.Add(s.ttl)
+		s.queries[id] = q
+		s.mu.Unlock()
+	}
+	writeJSON(w, r, s.page(id, q, 0))
+}
+
+func (s *Server) queryPage(w http.ResponseWriter, r *http.Request, id string, page int) {
+	s.mu.Lock()
+	s.evict(time.Now())
+	q, ok := s.queries[id]
+	s.mu.Unlock()
+	if !ok || page <= 0 || page >= len(q.pages) {
+		writeError(w, http.StatusNotFound, "NotFound", fmt.Sprintf("query %s has no page %d", id, page))
+		return
+	}
+	if !wait(r, q.fixture.Latency) {
+		return
+	}
+	s.mu.Lock()
+	q.expires = time.Now().Add(s.ttl)
+	if page == len(q.pages)-1 {
+		q.done = true
+	}
+	s.mu.Unlock()
+	writeJSON(w, r, s.page(id, q, page))
+}
+
+// finishQuery forgets a query, its remaining pages are not wanted or the
+// client has read all of them.
+func (s *Server) finishQuery(w http.ResponseWriter, r *http.Request, id string) {
+	s.mu.Lock()
+	delete(s.queries, id)
+	s.mu.Unlock()
+	writeJSON(w, r, dc.QueryResponse{Id: id, State: "Succeeded"})
+}
+
+func (s *Server) page(id string, q *query, page int) dc.QueryResponse {
+	resp := dc.QueryResponse{
+		Id:       id,
+		Schema:   q.schema,
+		Data:     q.pages[page],
+		State:    "Succeeded",
+		FinalURI: fmt.Sprintf("/v1/query/%s/final", id),
+		Stats: dc.QueryStats{
+			RunningTimeMS: float64(q.fixture.Latency.Milliseconds()),
+			ScanProgress:  dc.QueryProgress{Rows: uint64(len(q.fixture.Rows))},
+		},
+	}
+	if page < len(q.pages)-1 {
+		resp.State = "Running"
+		resp.NextURI = fmt.Sprintf("/v1/query/%s/page/%d", id, page+1)
+	}
+	return resp
+}
+
+func (s *Server) match(sql string) *Fixture {
+	for _, f := range s.fixtures.Queries {
+		if f.matches(sql) {
+			return f
+		}
+	}
+	return nil
+}
+
+// paginate splits rows into pages of size rows, there is always one page.
+func paginate(rows [][]string, size int) [][][]string {
+	if size <= 0 || len(rows) <= size {
+		return [][][]string{nonNil(rows)}
+	}
+	var pages [][][]string
+	for len(rows) > 0 {
+		n := size
+		if n > len(rows) {
+			n = len(rows)
+		}
+		pages = append(pages, rows[:n])
+		rows = rows[n:]
+	}
+	return pages
+}
+
+// nonNil makes empty results encode as [] like Databend does.
+func nonNil(rows [][]string) [][]string {
+	if rows == nil {
+		return [][]string{}
+	}
+	return rows
+}
+
+// wait sleeps for d, it returns false if the client went away meanwhile.
+func wait(r *http.Request, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+// writeJSON compresses v with gzip if the client accepts it, as Databend
+// does.
+func writeJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		_ = json.NewEncoder(w).Encode(v)
+		return
+	}
+	w.Header().Set("Content-Encoding", "gzip")
+	zw := gzip.NewWriter(w)
+	_ = json.NewEncoder(zw).Encode(v)
+	_ = zw.Close()
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(dc.APIErrorResponseBody{Error: code, Message: message})
+}
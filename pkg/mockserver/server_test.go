@@ -0,0 +1,301 @@
+// Copyright 2022 Datafuse Labs.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mockserver_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	dc "github.com/databendcloud/databend-go"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/databendcloud/bendsql/api"
+	"github.com/databendcloud/bendsql/pkg/mockserver"
+)
+
+func newServer(t *testing.T) (*mockserver.Server, *httptest.Server) {
+	fixtures, err := mockserver.LoadFixtures("testdata/queries.yaml")
+	assert.NoError(t, err)
+	s, err := mockserver.New(fixtures)
+	assert.NoError(t, err)
+	return s, httptest.NewServer(s)
+}
+
+func TestLoadFixtures(t *testing.T) {
+	fixtures, err := mockserver.LoadFixtures("testdata/queries.yaml")
+	assert.NoError(t, err)
+	users := fixtures.Queries[1]
+	assert.Equal(t, []mockserver.Column{{Name: "id", Type: "UInt64"}, {Name: "name", Type: "String"}}, users.Schema)
+	assert.Equal(t, [][]string{{"1", "alice"}, {"2", "bob"}, {"3", "carol"}}, users.Rows)
+	assert.Equal(t, 2, users.PageSize)
+
+	_, err = mockserver.ParseFixtures([]byte("queries: [{match: '('}]"), ".")
+	assert.Error(t, err)
+	_, err = mockserver.ParseFixtures([]byte("queries: [{match: x, schema: [{name: a}], rows: [[1, 2]]}]"), ".")
+	assert.Error(t, err)
+	_, err = mockserver.New(&mockserver.Fixtures{Queries: []*mockserver.Fixture{{}}})
+	assert.Error(t, err)
+}
+
+func TestServerQuerySync(t *testing.T) {
+	s, srv := newServer(t)
+	defer srv.Close()
+	c, err := api.New(api.WithEndpoint(srv.URL), api.WithTokenSource(api.StaticToken("token")))
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	respCh := make(chan dc.QueryResponse, 10)
+	assert.NoError(t, c.QuerySync(ctx, "default", "SELECT id, name FROM users", respCh))
+	close(respCh)
+	var pages [][][]string
+	for resp := range respCh {
+		assert.Equal(t, "name", resp.Schema[1].Name)
+		pages = append(pages, resp.Data)
+	}
+	assert.Equal(t, [][][]string{{{"1", "alice"}, {"2", "bob"}}, {{"3", "carol"}}}, pages)
+	assert.Equal(t, 0, s.Running())
+
+	_, err = c.Query(ctx, "default", "SELECT * FROM missing")
+	var apiErr *api.Error
+	if assert.ErrorAs(t, err, &apiErr) {
+		assert.Equal(t, api.ErrorQuery, apiErr.Kind)
+		assert.Equal(t, 1025, apiErr.Code)
+	}
+	_, err = c.Query(ctx, "default", "SELECT * FROM flaky")
+	var statusErr dc.APIError
+	if assert.ErrorAs(t, err, &statusErr) {
+		assert.Equal(t, http.StatusServiceUnavailable, statusErr.StatusCode)
+	}
+	_, err = c.Query(ctx, "default", "SELECT 2")
+	assert.ErrorContains(t, err, "no fixture matches")
+
+	assert.Equal(t, []string{"SELECT id, name FROM users", "SELECT * FROM missing", "SELECT * FROM flaky", "SELECT 2"}, s.Queries())
+}
+
+func TestServerQueryRows(t *testing.T) {
+	s, srv := newServer(t)
+	defer srv.Close()
+	c, err := api.New(api.WithEndpoint(srv.URL), api.WithTokenSource(api.StaticToken("token")))
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	rows, err := c.QueryRows(ctx, "default", "SELECT id, name FROM users")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"id", "name"}, rows.Columns())
+	type user struct {
+		ID   uint64 `db:"id"`
+		Name string `db:"name"`
+	}
+	var users []user
+	for rows.Next() {
+		var u user
+		assert.NoError(t, rows.Scan(&u))
+		users = append(users, u)
+	}
+	assert.NoError(t, rows.Err())
+	assert.NoError(t, rows.Close())
+	assert.Equal(t, []user{{1, "alice"}, {2, "bob"}, {3, "carol"}}, users)
+
+	// closing before the last page releases the query
+	rows, err = c.QueryRows(ctx, "default", "SELECT id, name FROM users")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, s.Running())
+	assert.NoError(t, rows.Close())
+	assert.Equal(t, 0, s.Running())
+
+	_, err = c.QueryRows(ctx, "default", "SELECT * FROM missing")
+	assert.ErrorContains(t, err, "Unknown table")
+}
+
+func TestServerCompression(t *testing.T) {
+	s, _ := newServer(t)
+	var encodings []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encodings = append(encodings, r.Header.Get("Accept-Encoding"))
+		s.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	for _, disable := range []bool{false, true} {
+		encodings = nil
+		c, err := api.New(api.WithEndpoint(srv.URL), api.WithTokenSource(api.StaticToken("token")),
+			api.WithPaging(api.PagingOptions{DisableCompression: disable}))
+		assert.NoError(t, err)
+		rows, err := c.QueryRows(context.Background(), "default", "SELECT id, name FROM users")
+		assert.NoError(t, err)
+		n := 0
+		for rows.Next() {
+			n++
+		}
+		assert.NoError(t, rows.Err())
+		assert.Equal(t, 3, n)
+		assert.Len(t, encodings, 2)
+		for _, encoding := range encodings {
+			if disable {
+				assert.Equal(t, "identity", encoding)
+			} else {
+				assert.Equal(t, "gzip", encoding)
+			}
+		}
+	}
+}
+
+func TestServerDriver(t *testing.T) {
+	s, srv := newServer(t)
+	defer srv.Close()
+	db, err := sql.Open("databend", "databend://root:@"+strings.TrimPrefix(srv.URL, "http://")+"/default?sslmode=disable")
+	assert.NoError(t, err)
+	defer db.Close()
+
+	var one uint8
+	assert.NoError(t, db.QueryRow("select 1").Scan(&one))
+	assert.Equal(t, uint8(1), one)
+
+	rows, err := db.Query("SELECT id, name FROM users")
+	assert.NoError(t, err)
+	var names []string
+	for rows.Next() {
+		var id uint64
+		var name string
+		assert.NoError(t, rows.Scan(&id, &name))
+		names = append(names, name)
+	}
+	assert.NoError(t, rows.Err())
+	assert.NoError(t, rows.Close())
+	assert.Equal(t, []string{"alice", "bob", "carol"}, names)
+
+	// closing early fetches the next page, which ends the query
+	rows, err = db.Query("SELECT id, name FROM users")
+	assert.NoError(t, err)
+	assert.NoError(t, rows.Close())
+	assert.Equal(t, 0, s.Running())
+}
+
+func TestServerLatency(t *testing.T) {
+	fixtures, err := mockserver.ParseFixtures([]byte("latency: 1s\nqueries: [{match: '.*'}]"), ".")
+	assert.NoError(t, err)
+	s, err := mockserver.New(fixtures)
+	assert.NoError(t, err)
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	c, err := api.New(api.WithEndpoint(srv.URL), api.WithTokenSource(api.StaticToken("token")))
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = c.Query(ctx, "default", "SELECT 1")
+	assert.EqualError(t, err, "query cancelled, but it may still be running on the server: query ID unknown")
+}
+
+func TestServerCancel(t *testing.T) {
+	fixtures, err := mockserver.ParseFixtures([]byte(`
+latency: 100ms
+page_size: 1
+queries:
+  - match: .*
+    schema: [{name: n, type: UInt8}]
+    rows: [["1"], ["2"], ["3"]]
+`), ".")
+	assert.NoError(t, err)
+	s, err := mockserver.New(fixtures)
+	assert.NoError(t, err)
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	c, err := api.New(api.WithEndpoint(srv.URL), api.WithTokenSource(api.StaticToken("token")))
+	assert.NoError(t, err)
+
+	// cancelled after the first page, while the second is fetched
+	ctx, cancel := context.WithCancel(context.Background())
+	respCh := make(chan dc.QueryResponse)
+	go func() {
+		<-respCh
+		cancel()
+	}()
+	err = c.QuerySync(ctx, "default", "SELECT n", respCh)
+	var cancelled *api.QueryCancelledError
+	if assert.ErrorAs(t, err, &cancelled) {
+		assert.Equal(t, "mock-1", cancelled.ID)
+	}
+	assert.Equal(t, 0, s.Running())
+
+	// the same through the driver
+	db := api.OpenDB(func() (string, error) {
+		return "databend://root:@" + strings.TrimPrefix(srv.URL, "http://") + "/default?sslmode=disable", nil
+	})
+	defer db.Close()
+	ctx, cancel = context.WithCancel(context.Background())
+	rows, err := db.QueryContext(ctx, "SELECT n")
+	assert.NoError(t, err)
+	assert.True(t, rows.Next())
+	cancel()
+	for rows.Next() {
+	}
+	// database/sql may close the rows before they see the cancellation,
+	// either way the query is stopped
+	assert.ErrorIs(t, rows.Err(), context.Canceled)
+	assert.Equal(t, 0, s.Running())
+}
+
+func TestServerQueryTTL(t *testing.T) {
+	fixtures, err := mockserver.ParseFixtures([]byte(`
+query_ttl: 50ms
+page_size: 1
+queries:
+  - match: .*
+    schema: [{name: n, type: UInt8}]
+    rows: [["1"], ["2"]]
+`), ".")
+	assert.NoError(t, err)
+	s, err := mockserver.New(fixtures)
+	assert.NoError(t, err)
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	start := func() dc.QueryResponse {
+		resp, err := http.Post(srv.URL+"/v1/query", "application/json", strings.NewReader(`{"sql": "SELECT n"}`))
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		var first dc.QueryResponse
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&first))
+		return first
+	}
+	get := func(uri string) int {
+		resp, err := http.Get(srv.URL + uri)
+		assert.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// the last page can be fetched again until the query is finished
+	first := start()
+	assert.Equal(t, http.StatusOK, get(first.NextURI))
+	assert.Equal(t, 0, s.Running())
+	assert.Equal(t, http.StatusOK, get(first.NextURI))
+	assert.Equal(t, http.StatusOK, get(first.FinalURI))
+	assert.Equal(t, http.StatusNotFound, get(first.NextURI))
+
+	// abandoned queries are forgotten after the TTL
+	first = start()
+	assert.Equal(t, 1, s.Running())
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 0, s.Running())
+	assert.Equal(t, http.StatusNotFound, get(first.NextURI))
+}